@@ -0,0 +1,306 @@
+package datanode_coord
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+var crdtMetaBucket = []byte("crdt_meta")
+
+// LWWRegister is a single last-writer-wins value in the CRDT metadata
+// layer. Conflicting writes are resolved by Lamport timestamp, then by
+// node id as a deterministic tiebreaker.
+type LWWRegister struct {
+	Value     string
+	Timestamp int64
+	NodeID    uint64
+}
+
+// laterThan reports whether self should win over other under LWW rules.
+func (r LWWRegister) laterThan(other LWWRegister) bool {
+	if r.Timestamp != other.Timestamp {
+		return r.Timestamp > other.Timestamp
+	}
+	return r.NodeID > other.NodeID
+}
+
+// crdtKey identifies one (namespace, partition, field) metadata slot, e.g.
+// (test, 0, "hostname") or (test, 0, "drain_weight").
+type crdtKey struct {
+	Namespace string
+	Partition int
+	Field     string
+}
+
+func (k crdtKey) String() string {
+	return k.Namespace + "-" + strconv.Itoa(k.Partition) + "-" + k.Field
+}
+
+// CRDTStore is an OR-Map of LWW-Registers used for advisory coordinator
+// metadata that doesn't need linearizability: observed node attributes,
+// raft-leader hints, replica lag, tags and operator annotations. It is
+// strictly eventually consistent -- the register/etcd-backed metadata
+// remains the source of truth for membership and raft group composition.
+type CRDTStore struct {
+	mutex   sync.Mutex
+	lamport uint64
+	nodeID  uint64
+	values  map[string]LWWRegister
+	db      *bolt.DB
+}
+
+// NewCRDTStore opens (creating if needed) a local BoltDB file to persist
+// the CRDT metadata layer across restarts.
+func NewCRDTStore(dbPath string, nodeID uint64) (*CRDTStore, error) {
+	db, err := bolt.Open(dbPath, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(crdtMetaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	store := &CRDTStore{
+		nodeID: nodeID,
+		values: make(map[string]LWWRegister),
+		db:     db,
+	}
+	if err := store.loadFromDisk(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *CRDTStore) loadFromDisk() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(crdtMetaBucket)
+		return b.ForEach(func(k, v []byte) error {
+			var reg LWWRegister
+			if err := json.Unmarshal(v, &reg); err != nil {
+				return nil
+			}
+			s.values[string(k)] = reg
+			return nil
+		})
+	})
+}
+
+func (s *CRDTStore) persist(key string, reg LWWRegister) {
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(crdtMetaBucket).Put([]byte(key), data)
+	})
+	if err != nil {
+		CoordLog().Infof("failed to persist crdt metadata %v: %v", key, err)
+	}
+}
+
+// Set writes a local value for the given key, stamping it with a fresh
+// Lamport timestamp so it wins any future merge against stale remote
+// copies (including our own earlier writes).
+func (s *CRDTStore) Set(namespace string, partition int, field string, value string) {
+	s.mutex.Lock()
+	s.lamport++
+	reg := LWWRegister{Value: value, Timestamp: int64(s.lamport), NodeID: s.nodeID}
+	key := (crdtKey{namespace, partition, field}).String()
+	s.values[key] = reg
+	s.mutex.Unlock()
+	s.persist(key, reg)
+}
+
+// Get returns the current value for a key, or ("", false) if unknown.
+func (s *CRDTStore) Get(namespace string, partition int, field string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	reg, ok := s.values[(crdtKey{namespace, partition, field}).String()]
+	if !ok {
+		return "", false
+	}
+	return reg.Value, true
+}
+
+// Delta returns every key/value pair this node currently holds, to gossip
+// to a peer.
+func (s *CRDTStore) Delta() map[string]LWWRegister {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	out := make(map[string]LWWRegister, len(s.values))
+	for k, v := range s.values {
+		out[k] = v
+	}
+	return out
+}
+
+// Merge applies a remote delta: for each key, the value with the higher
+// Lamport timestamp (node id as tiebreak) wins.
+func (s *CRDTStore) Merge(delta map[string]LWWRegister) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k, remote := range delta {
+		local, ok := s.values[k]
+		if !ok || remote.laterThan(local) {
+			s.values[k] = remote
+			if remote.Timestamp > int64(s.lamport) {
+				s.lamport = uint64(remote.Timestamp)
+			}
+			s.persist(k, remote)
+		}
+	}
+}
+
+func (s *CRDTStore) Close() {
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+// EnableCRDTMeta turns on the optional CRDT anti-entropy subsystem for
+// advisory metadata, backed by a local BoltDB file under dbPath.
+func (self *DataCoordinator) EnableCRDTMeta(dbPath string) error {
+	store, err := NewCRDTStore(dbPath, self.GetMyRegID())
+	if err != nil {
+		return err
+	}
+	self.crdt = store
+	return nil
+}
+
+// crdtGossipLoop periodically exchanges CRDT deltas with the ISR peers of
+// every namespace this node hosts, over a plain HTTP POST to the existing
+// coordinator admin endpoint -- reusing the cluster's membership channel
+// rather than opening a new transport.
+func (self *DataCoordinator) crdtGossipLoop() {
+	defer self.wg.Done()
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stopChan:
+			return
+		case <-ticker.C:
+			self.gossipCRDTOnce()
+		}
+	}
+}
+
+func (self *DataCoordinator) gossipCRDTOnce() {
+	if self.crdt == nil {
+		return
+	}
+	// advertise our own hostname before gossiping, so peers always see a
+	// fresh heartbeat even if nothing else changed. Replica lag is not
+	// advertised.
+	for name := range self.localNSMgr.GetNamespaces() {
+		namespace, pid := common.GetNamespaceAndPartition(name)
+		if namespace == "" {
+			continue
+		}
+		self.crdt.Set(namespace, pid, "hostname", self.myNode.NodeIP)
+	}
+
+	delta := self.crdt.Delta()
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return
+	}
+	peers := make(map[string]bool)
+	for name := range self.localNSMgr.GetNamespaces() {
+		namespace, pid := common.GetNamespaceAndPartition(name)
+		if namespace == "" {
+			continue
+		}
+		nsInfo, err := self.register.GetNamespacePartInfo(namespace, pid)
+		if err != nil {
+			continue
+		}
+		for _, nid := range nsInfo.GetISR() {
+			if nid != self.GetMyID() {
+				peers[nid] = true
+			}
+		}
+	}
+	for nid := range peers {
+		nip, _, _, httpPort := ExtractNodeInfoFromID(nid)
+		url := "http://" + net.JoinHostPort(nip, httpPort) + common.APICRDTGossip
+		err := common.APIRequest("POST", url, bytes.NewReader(data), time.Second*3, nil)
+		if err != nil {
+			CoordLog().Infof("failed to gossip crdt metadata to %v: %v", nid, err)
+		}
+	}
+}
+
+// ApplyRemoteCRDTDelta merges a delta received from a peer's gossip push.
+// It is the handler side for the endpoint crdtGossipLoop posts to.
+func (self *DataCoordinator) ApplyRemoteCRDTDelta(delta map[string]LWWRegister) {
+	if self.crdt == nil {
+		return
+	}
+	self.crdt.Merge(delta)
+}
+
+// drainWeightOf returns the CRDT-advertised "drain weight" hint for a node
+// in a namespace partition -- a lower value means the peer is a better
+// target to receive leadership during a drain. Unknown peers score 0 so
+// they are treated as a neutral (not worst) choice.
+func (self *DataCoordinator) drainWeightOf(namespace string, partition int, nid string) float64 {
+	if self.crdt == nil {
+		return 0
+	}
+	regID := ExtractRegIDFromGenID(nid)
+	val, ok := self.crdt.Get(namespace, partition, "drain_weight_"+strconv.FormatUint(regID, 10))
+	if !ok {
+		return 0
+	}
+	w, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+// pickLeastLoadedISRMember picks the ISR member (other than ourselves)
+// with the lowest CRDT-advertised drain weight, falling back to the
+// placement-ranked choice when no CRDT hints are available.
+func (self *DataCoordinator) pickLeastLoadedISRMember(nsInfo *PartitionMetaInfo, spec *PlacementSpec) string {
+	if self.crdt == nil {
+		return self.pickBestISRMember(nsInfo, spec)
+	}
+	var best string
+	bestWeight := 0.0
+	hinted := false
+	for _, nid := range nsInfo.GetISR() {
+		if nid == self.GetMyID() {
+			continue
+		}
+		regID := strconv.FormatUint(ExtractRegIDFromGenID(nid), 10)
+		if _, ok := self.crdt.Get(nsInfo.Name, nsInfo.Partition, "drain_weight_"+regID); ok {
+			hinted = true
+		}
+		w := self.drainWeightOf(nsInfo.Name, nsInfo.Partition, nid)
+		if best == "" || w < bestWeight {
+			best = nid
+			bestWeight = w
+		}
+	}
+	if best == "" || !hinted {
+		return self.pickBestISRMember(nsInfo, spec)
+	}
+	return best
+}
@@ -0,0 +1,55 @@
+package datanode_coord
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLWWRegisterLaterThanPrefersHigherTimestamp(t *testing.T) {
+	older := LWWRegister{Value: "a", Timestamp: 1, NodeID: 5}
+	newer := LWWRegister{Value: "b", Timestamp: 2, NodeID: 1}
+
+	if !newer.laterThan(older) {
+		t.Fatalf("expected higher timestamp to win regardless of node id")
+	}
+	if older.laterThan(newer) {
+		t.Fatalf("expected lower timestamp to lose")
+	}
+}
+
+func TestLWWRegisterLaterThanTiebreaksOnNodeID(t *testing.T) {
+	a := LWWRegister{Value: "a", Timestamp: 5, NodeID: 1}
+	b := LWWRegister{Value: "b", Timestamp: 5, NodeID: 2}
+
+	if a.laterThan(b) {
+		t.Fatalf("expected lower node id to lose the tiebreak")
+	}
+	if !b.laterThan(a) {
+		t.Fatalf("expected higher node id to win the tiebreak")
+	}
+}
+
+func TestCRDTStoreMergePrefersLaterWrite(t *testing.T) {
+	store, err := NewCRDTStore(filepath.Join(t.TempDir(), "crdt.db"), 1)
+	if err != nil {
+		t.Fatalf("NewCRDTStore: %v", err)
+	}
+	defer store.Close()
+
+	store.Merge(map[string]LWWRegister{
+		"k": {Value: "old", Timestamp: 1, NodeID: 1},
+	})
+	store.Merge(map[string]LWWRegister{
+		"k": {Value: "stale", Timestamp: 0, NodeID: 9},
+	})
+	if got := store.Delta()["k"].Value; got != "old" {
+		t.Fatalf("expected stale write to lose, got %v", got)
+	}
+
+	store.Merge(map[string]LWWRegister{
+		"k": {Value: "new", Timestamp: 2, NodeID: 1},
+	})
+	if got := store.Delta()["k"].Value; got != "new" {
+		t.Fatalf("expected later write to win, got %v", got)
+	}
+}
@@ -2,6 +2,7 @@ package datanode_coord
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	. "github.com/absolute8511/ZanRedisDB/cluster"
@@ -23,8 +24,21 @@ var (
 
 const (
 	MAX_RAFT_JOIN_RUNNING = 5
+	// DefaultLearnerCatchupThreshold is the max allowed gap (in raft log entries)
+	// between a learner's applied index and the leader's committed index before
+	// the learner is considered caught up and eligible for promotion to voter.
+	DefaultLearnerCatchupThreshold = 100
 )
 
+// LearnerCatchupThreshold is configurable so operators can tune how close a
+// learner must be to the leader before it is promoted to a full voting member.
+var LearnerCatchupThreshold uint64 = DefaultLearnerCatchupThreshold
+
+// UnderReplicatedGracePeriod is how long a namespace partition may stay
+// under-replicated before the leader logs a warning naming it as a
+// candidate for filling the vacancy from a warm standby node.
+var UnderReplicatedGracePeriod = time.Minute * 5
+
 func GetNamespacePartitionFileName(namespace string, partition int, suffix string) string {
 	var tmpbuf bytes.Buffer
 	tmpbuf.WriteString(namespace)
@@ -38,33 +52,68 @@ func GetNamespacePartitionBasePath(rootPath string, namespace string, partition
 	return filepath.Join(rootPath, namespace)
 }
 
+// the coordinator can run either as a full participant (joins raft groups
+// and serves the namespaces assigned to it) or as a warm standby that only
+// registers with the PD and watches namespace metadata until promoted.
+const (
+	ModeParticipant int = iota
+	ModeStandby
+)
+
 type DataCoordinator struct {
-	clusterKey       string
-	register         DataNodeRegister
-	pdMutex          sync.Mutex
-	pdLeader         NodeInfo
-	myNode           NodeInfo
-	stopChan         chan struct{}
-	tryCheckUnsynced chan bool
-	wg               sync.WaitGroup
-	stopping         int32
-	catchupRunning   int32
-	localNSMgr       *node.NamespaceMgr
+	clusterKey           string
+	register             DataNodeRegister
+	pdMutex              sync.Mutex
+	pdLeader             NodeInfo
+	myNode               NodeInfo
+	stopChan             chan struct{}
+	tryCheckUnsynced     chan bool
+	wg                   sync.WaitGroup
+	stopping             int32
+	catchupRunning       int32
+	localNSMgr           *node.NamespaceMgr
+	curMode              int32
+	underReplicatedMutex sync.Mutex
+	underReplicatedSince map[string]time.Time
+	membership           MembershipBackend
+	membershipRev        int64
+	crdt                 *CRDTStore
+	drainMutex           sync.Mutex
+	drainCancel          context.CancelFunc
+	drainReport          *DrainReport
 }
 
 func NewDataCoordinator(cluster string, nodeInfo *NodeInfo, nsMgr *node.NamespaceMgr) *DataCoordinator {
 	coord := &DataCoordinator{
-		clusterKey:       cluster,
-		register:         nil,
-		myNode:           *nodeInfo,
-		stopChan:         make(chan struct{}),
-		tryCheckUnsynced: make(chan bool, 1),
-		localNSMgr:       nsMgr,
+		clusterKey:           cluster,
+		register:             nil,
+		myNode:               *nodeInfo,
+		stopChan:             make(chan struct{}),
+		tryCheckUnsynced:     make(chan bool, 1),
+		localNSMgr:           nsMgr,
+		curMode:              int32(ModeParticipant),
+		underReplicatedSince: make(map[string]time.Time),
 	}
 
 	return coord
 }
 
+// SetStandbyMode marks this node as a warm spare before it is started: it
+// will register with the PD and watch namespace metadata, but will not join
+// any raft group or run updateLocalNamespace until promoted with
+// PromoteToParticipant.
+func (self *DataCoordinator) SetStandbyMode(standby bool) {
+	if standby {
+		atomic.StoreInt32(&self.curMode, int32(ModeStandby))
+	} else {
+		atomic.StoreInt32(&self.curMode, int32(ModeParticipant))
+	}
+}
+
+func (self *DataCoordinator) IsStandby() bool {
+	return atomic.LoadInt32(&self.curMode) == int32(ModeStandby)
+}
+
 func (self *DataCoordinator) GetMyID() string {
 	return self.myNode.GetID()
 }
@@ -108,11 +157,34 @@ func (self *DataCoordinator) Start() error {
 			return err
 		}
 	}
+	self.wg.Add(1)
+	go self.watchPD()
+
+	if self.membership != nil {
+		self.wg.Add(1)
+		go self.watchMembershipChanges()
+	}
+
+	if self.crdt != nil {
+		self.wg.Add(1)
+		go self.crdtGossipLoop()
+	}
+
+	if self.IsStandby() {
+		self.wg.Add(1)
+		go self.standbyHandler()
+		return nil
+	}
+	return self.startParticipant()
+}
+
+// startParticipant brings up the full data-serving path: local namespace
+// manager, namespace data load and the periodic sync checker. It is used
+// both on initial Start and when a standby node is promoted.
+func (self *DataCoordinator) startParticipant() error {
 	if self.localNSMgr != nil {
 		self.localNSMgr.Start()
 	}
-	self.wg.Add(1)
-	go self.watchPD()
 
 	err := self.loadLocalNamespaceData()
 	if err != nil {
@@ -125,6 +197,87 @@ func (self *DataCoordinator) Start() error {
 	return nil
 }
 
+// standbyHandler keeps a lightweight watch on namespace metadata while this
+// node is a warm spare: it never runs updateLocalNamespace and never
+// appears in any RaftNodes/ISR until promoted via PromoteToParticipant,
+// which CAS's curMode and drives startParticipant itself rather than
+// signaling this goroutine. This just notices the mode flip and exits so it
+// doesn't idle for the rest of the process's life once promoted.
+func (self *DataCoordinator) standbyHandler() {
+	defer self.wg.Done()
+	nsChangedChan := self.register.GetNamespacesNotifyChan()
+	for {
+		select {
+		case <-self.stopChan:
+			return
+		case <-nsChangedChan:
+			if !self.IsStandby() {
+				return
+			}
+			// standby nodes only observe; nothing to reconcile locally.
+		}
+	}
+}
+
+// PromoteToParticipant flips this node from standby to a full participant
+// and joins the given namespace partition's raft group through the normal
+// updateLocalNamespace/ensureJoinNamespaceGroup path, rather than relying on
+// the generic periodic loop to notice this node on its own. It is meant to
+// be invoked by the PD when filling a persistently under-replicated ISR
+// vacancy with a warm spare, and is safe to retry: the namespace lookup runs
+// before any mode change, and the join itself
+// (checkLocalNamespaceMagicCode/updateLocalNamespace/ensureJoinNamespaceGroup)
+// is idempotent, so a retry after this node is already a participant still
+// drives the join instead of silently no-op'ing. A startParticipant failure
+// is not rolled back to standby: like any other startParticipant failure
+// (see Start()) it already closes stopChan and is fatal to the node, so
+// retrying would risk calling startParticipant a second time and closing
+// stopChan twice.
+//
+// The mode flip uses a CAS instead of the async modeC channel standbyHandler
+// used to listen on: sending on modeC and then also driving the join inline
+// here would start two goroutines (standbyHandler's startParticipant and
+// this call) racing to init/join the same local namespace. CAS'ing curMode
+// ourselves and calling startParticipant synchronously makes this call the
+// sole driver of the one-time mode flip.
+func (self *DataCoordinator) PromoteToParticipant(namespace string, partition int) error {
+	nsInfo, err := self.register.GetNamespacePartInfo(namespace, partition)
+	if err != nil {
+		CoordLog().Errorf("failed to get namespace %v-%v meta while promoting: %v", namespace, partition, err)
+		return err
+	}
+	if _, ok := nsInfo.RaftIDs[self.GetMyID()]; !ok {
+		CoordLog().Warningf("namespace %v has no raft id assigned for %v yet, can not join its group",
+			nsInfo.GetDesp(), self.GetMyID())
+		return ErrNamespaceConfInvalid
+	}
+
+	if atomic.CompareAndSwapInt32(&self.curMode, int32(ModeStandby), int32(ModeParticipant)) {
+		CoordLog().Infof("standby node %v promoting to participant for namespace %v-%v",
+			self.GetMyID(), namespace, partition)
+		if err := self.startParticipant(); err != nil {
+			CoordLog().Errorf("failed to start as participant while promoting for namespace %v: %v", nsInfo.GetDesp(), err)
+			return err
+		}
+	}
+
+	checkErr := self.checkLocalNamespaceMagicCode(nsInfo, true)
+	if checkErr != nil {
+		CoordLog().Errorf("failed to check namespace %v while promoting: %v", nsInfo.GetDesp(), checkErr)
+		return checkErr
+	}
+	localNamespace, coordErr := self.updateLocalNamespace(nsInfo)
+	if coordErr != nil {
+		CoordLog().Errorf("failed to init/update local namespace %v while promoting: %v", nsInfo.GetDesp(), coordErr)
+		return coordErr
+	}
+	if joinErr := self.ensureJoinNamespaceGroup(*nsInfo, localNamespace); joinErr != nil {
+		CoordLog().Errorf("failed to join namespace %v group while promoting: %v", nsInfo.GetDesp(), joinErr)
+		return joinErr
+	}
+	return nil
+}
+
 func (self *DataCoordinator) Stop() {
 	if atomic.LoadInt32(&self.stopping) == 1 {
 		return
@@ -169,6 +322,35 @@ func (self *DataCoordinator) watchPD() {
 	}
 }
 
+// watchMembershipChanges drives namespace reconciliation off the pluggable
+// MembershipBackend's real change stream (when configured) instead of
+// relying solely on the fixed 10-minute polling ticker in
+// checkForUnsyncedNamespaces.
+func (self *DataCoordinator) watchMembershipChanges() {
+	defer self.wg.Done()
+	for {
+		select {
+		case <-self.stopChan:
+			return
+		default:
+		}
+		newRev, err := self.membership.WatchNamespaces(self.membershipRev, self.stopChan)
+		if err != nil {
+			CoordLog().Infof("watch membership backend failed: %v", err)
+			select {
+			case <-self.stopChan:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if newRev != self.membershipRev {
+			self.membershipRev = newRev
+			self.tryCheckNamespaces()
+		}
+	}
+}
+
 func (self *DataCoordinator) checkLocalNamespaceMagicCode(nsInfo *PartitionMetaInfo, tryFix bool) error {
 	if nsInfo.MagicCode <= 0 {
 		return nil
@@ -260,12 +442,32 @@ func (self *DataCoordinator) loadLocalNamespaceData() error {
 	return nil
 }
 
+// voterISRList returns the ISR members that are full voters, excluding any
+// member that is currently joining as a non-voting learner. Learners must
+// never be counted toward quorum or replica-enough decisions.
+func (self *DataCoordinator) voterISRList(nsInfo *PartitionMetaInfo) []string {
+	isrList := nsInfo.GetISR()
+	voters := make([]string, 0, len(isrList))
+	for _, nid := range isrList {
+		if _, ok := nsInfo.LearnerIDs[nid]; ok {
+			continue
+		}
+		voters = append(voters, nid)
+	}
+	return voters
+}
+
 func (self *DataCoordinator) isMeInRaftGroup(nsInfo *PartitionMetaInfo) (bool, error) {
 	var lastErr error
 	for _, remoteNode := range nsInfo.GetISR() {
 		if remoteNode == self.GetMyID() {
 			continue
 		}
+		if _, ok := nsInfo.LearnerIDs[remoteNode]; ok {
+			// learners are not full raft voters yet, skip asking them for
+			// the authoritative member list
+			continue
+		}
 		nip, _, _, httpPort := ExtractNodeInfoFromID(remoteNode)
 		var rsp []*common.MemberInfo
 		err := common.APIRequest("GET",
@@ -334,8 +536,17 @@ func (self *DataCoordinator) isNamespaceShouldStop(nsInfo PartitionMetaInfo, loc
 	return false
 }
 
+// checkAndFixLocalNamespaceData decides whether the local namespace can
+// catch up purely by raft log replay, or whether it is far enough behind
+// (or its data is marked broken) that a snapshot transfer from a healthy
+// ISR peer is needed first so the leader only has to ship incremental
+// entries afterwards.
 func (self *DataCoordinator) checkAndFixLocalNamespaceData(nsInfo *PartitionMetaInfo, localNamespace *node.NamespaceNode) error {
-	return nil
+	if !self.needsSnapshotCatchup(nsInfo, localNamespace) {
+		return nil
+	}
+	CoordLog().Infof("namespace %v needs snapshot catchup", nsInfo.GetDesp())
+	return self.fetchSnapshotFromPeer(nsInfo, localNamespace)
 }
 
 func (self *DataCoordinator) addNamespaceRaftMember(nsInfo *PartitionMetaInfo, m *common.MemberInfo) {
@@ -358,6 +569,79 @@ func (self *DataCoordinator) addNamespaceRaftMember(nsInfo *PartitionMetaInfo, m
 	}
 }
 
+// addNamespaceRaftLearner proposes the given member as a non-voting learner
+// rather than a full voter. This lets a new replica catch up on the raft log
+// before it can affect quorum, mirroring etcd's learner design.
+func (self *DataCoordinator) addNamespaceRaftLearner(nsInfo *PartitionMetaInfo, m *common.MemberInfo) {
+	for nid, removing := range nsInfo.Removings {
+		if m.ID == removing.RemoveReplicaID && m.NodeID == ExtractRegIDFromGenID(nid) {
+			CoordLog().Infof("raft learner %v is marked as removing in meta: %v, ignore add raft learner", m, nsInfo.Removings)
+			return
+		}
+	}
+	nsNode := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
+	if nsNode == nil {
+		CoordLog().Infof("namespace %v not found while add learner", nsInfo.GetDesp())
+		return
+	}
+	m.Learner = true
+	err := nsNode.Node.ProposeAddLearner(*m)
+	if err != nil {
+		CoordLog().Infof("%v propose add learner %v failed: %v", nsInfo.GetDesp(), m, err)
+	} else {
+		CoordLog().Infof("namespace %v propose add learner %v", nsInfo.GetDesp(), m)
+	}
+}
+
+// promoteNamespaceLearner converts a caught-up learner into a full voting
+// member of the raft group.
+func (self *DataCoordinator) promoteNamespaceLearner(nsInfo *PartitionMetaInfo, m *common.MemberInfo) {
+	nsNode := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
+	if nsNode == nil {
+		CoordLog().Infof("namespace %v not found while promote learner", nsInfo.GetDesp())
+		return
+	}
+	err := nsNode.Node.ProposePromoteLearner(*m)
+	if err != nil {
+		CoordLog().Infof("%v propose promote learner %v failed: %v", nsInfo.GetDesp(), m, err)
+	} else {
+		CoordLog().Infof("namespace %v propose promote learner %v to voter", nsInfo.GetDesp(), m)
+	}
+}
+
+// checkLearnerCatchup proposes promotion for any learner whose applied index
+// has caught up close enough to the leader's committed index. It does not
+// update the partition metadata: the node stays in LearnerIDs in the
+// register after the promotion is proposed.
+func (self *DataCoordinator) checkLearnerCatchup(nsInfo *PartitionMetaInfo) {
+	if len(nsInfo.LearnerIDs) == 0 {
+		return
+	}
+	nsNode := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
+	if nsNode == nil {
+		return
+	}
+	leaderCommitted := nsNode.Node.GetCommittedIndex()
+	for nid, rid := range nsInfo.LearnerIDs {
+		appliedIndex, err := nsNode.Node.GetFollowerAppliedIndex(ExtractRegIDFromGenID(nid))
+		if err != nil {
+			CoordLog().Infof("failed to get applied index for learner %v: %v", nid, err)
+			continue
+		}
+		if leaderCommitted < appliedIndex || leaderCommitted-appliedIndex > LearnerCatchupThreshold {
+			continue
+		}
+		var m common.MemberInfo
+		m.ID = rid
+		m.NodeID = ExtractRegIDFromGenID(nid)
+		m.GroupID = uint64(nsInfo.MinGID) + uint64(nsInfo.Partition)
+		m.GroupName = nsInfo.GetDesp()
+		CoordLog().Infof("learner %v caught up (applied %v, committed %v), promoting to voter",
+			nid, appliedIndex, leaderCommitted)
+		self.promoteNamespaceLearner(nsInfo, &m)
+	}
+}
+
 func (self *DataCoordinator) removeNamespaceRaftMember(nsInfo *PartitionMetaInfo, m *common.MemberInfo) {
 	nsNode := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
 	if nsNode == nil {
@@ -373,6 +657,110 @@ func (self *DataCoordinator) removeNamespaceRaftMember(nsInfo *PartitionMetaInfo
 	}
 }
 
+// isLearnerRegID reports whether the given node register id is configured
+// as a learner for this namespace partition.
+func (self *DataCoordinator) isLearnerRegID(nsInfo *PartitionMetaInfo, regID uint64) bool {
+	for nid := range nsInfo.LearnerIDs {
+		if ExtractRegIDFromGenID(nid) == regID {
+			return true
+		}
+	}
+	return false
+}
+
+// diffRaftMembers compares the desired replica set (nsInfo.RaftIDs, minus
+// any being removed) against the raft group's current members and returns
+// the member changes needed to reconcile them: adds for replicas that
+// should be in the group but aren't yet, and removes for raft members that
+// are no longer wanted (stale members or ones explicitly marked removing).
+func (self *DataCoordinator) diffRaftMembers(nsInfo *PartitionMetaInfo, members []*common.MemberInfo) ([]common.MemberInfo, []common.MemberInfo) {
+	var adds []common.MemberInfo
+	for nid, rid := range nsInfo.RaftIDs {
+		if rm, ok := nsInfo.Removings[nid]; ok && rm.RemoveReplicaID == rid {
+			continue
+		}
+		found := false
+		for _, m := range members {
+			if m.ID == rid {
+				found = true
+				if m.NodeID != ExtractRegIDFromGenID(nid) {
+					CoordLog().Infof("found raft member %v mismatch the replica node: %v", m, nid)
+				}
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		var m common.MemberInfo
+		m.ID = rid
+		m.NodeID = ExtractRegIDFromGenID(nid)
+		m.GroupID = uint64(nsInfo.MinGID) + uint64(nsInfo.Partition)
+		m.GroupName = nsInfo.GetDesp()
+		raddr, err := self.getRaftAddrForNode(nid)
+		if err != nil {
+			CoordLog().Infof("failed to get raft address for node: %v, %v", nid, err)
+			continue
+		}
+		m.RaftURLs = append(m.RaftURLs, raddr)
+		adds = append(adds, m)
+	}
+
+	var removes []common.MemberInfo
+	for _, m := range members {
+		found := false
+		for nid, rid := range nsInfo.RaftIDs {
+			if m.ID == rid {
+				found = true
+				if m.NodeID != ExtractRegIDFromGenID(nid) {
+					CoordLog().Infof("found raft member %v mismatch the replica node: %v", m, nid)
+				}
+				break
+			}
+		}
+		if !found {
+			CoordLog().Infof("raft member %v not found in meta: %v", m, nsInfo.RaftNodes)
+			removes = append(removes, *m)
+			continue
+		}
+		for nid, removing := range nsInfo.Removings {
+			if m.ID == removing.RemoveReplicaID && m.NodeID == ExtractRegIDFromGenID(nid) {
+				CoordLog().Infof("raft member %v is marked as removing in meta: %v", m, nsInfo.Removings)
+				removes = append(removes, *m)
+			}
+		}
+	}
+	return adds, removes
+}
+
+// changeNamespaceMembersAtomic replaces the one-at-a-time add/remove
+// sequence with a single joint-consensus (Raft §4.3) configuration change,
+// so a full replica swap transitions Cold,new -> Cnew atomically and never
+// reduces the tolerated failure count mid-transition.
+func (self *DataCoordinator) changeNamespaceMembersAtomic(nsInfo *PartitionMetaInfo, adds, removes []common.MemberInfo) {
+	running := atomic.AddInt32(&self.catchupRunning, 1)
+	defer atomic.AddInt32(&self.catchupRunning, -1)
+	if running > MAX_RAFT_JOIN_RUNNING {
+		CoordLog().Infof("too many raft membership changes running (%v), deferring namespace %v joint change",
+			running, nsInfo.GetDesp())
+		self.tryCheckNamespaces()
+		return
+	}
+	nsNode := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
+	if nsNode == nil {
+		CoordLog().Infof("namespace %v not found while applying joint membership change", nsInfo.GetDesp())
+		return
+	}
+	err := nsNode.Node.ProposeConfChangeSet(adds, removes)
+	if err != nil {
+		CoordLog().Infof("namespace %v propose joint membership change (adds:%v removes:%v) failed: %v",
+			nsInfo.GetDesp(), adds, removes, err)
+	} else {
+		CoordLog().Infof("namespace %v propose joint membership change: adds:%v removes:%v",
+			nsInfo.GetDesp(), adds, removes)
+	}
+}
+
 func (self *DataCoordinator) getNamespaceRaftMembers(nsInfo *PartitionMetaInfo) []*common.MemberInfo {
 	nsNode := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
 	if nsNode == nil {
@@ -393,6 +781,48 @@ func (self *DataCoordinator) getNamespaceRaftLeader(nsInfo *PartitionMetaInfo) u
 	return m.NodeID
 }
 
+// zoneOfNode returns the zone label for the given node id, or an empty
+// string if the node info is unavailable.
+func (self *DataCoordinator) zoneOfNode(nid string) string {
+	if nid == self.GetMyID() {
+		return self.myNode.Zone
+	}
+	ninfo, err := self.register.GetNodeInfo(nid)
+	if err != nil {
+		return ""
+	}
+	return ninfo.Zone
+}
+
+// pickZoneBalancedLeader chooses which ISR voter should lead this partition
+// so that leaders for the namespace are spread across zones instead of
+// always picking the first ISR member. zoneLeaderCount tracks how many
+// partitions of this namespace already have their leader in each zone.
+// A namespace can pin leaders to a specific zone via ZoneAffinity, which
+// takes priority over balancing. Ties are broken by node id for determinism.
+func (self *DataCoordinator) pickZoneBalancedLeader(nsInfo *PartitionMetaInfo, voterList []string, zoneLeaderCount map[string]int) string {
+	if len(voterList) == 0 {
+		return ""
+	}
+	if nsInfo.ZoneAffinity != "" {
+		for _, nid := range voterList {
+			if self.zoneOfNode(nid) == nsInfo.ZoneAffinity {
+				return nid
+			}
+		}
+	}
+	best := voterList[0]
+	bestCount := zoneLeaderCount[self.zoneOfNode(best)]
+	for _, nid := range voterList[1:] {
+		cnt := zoneLeaderCount[self.zoneOfNode(nid)]
+		if cnt < bestCount || (cnt == bestCount && nid < best) {
+			best = nid
+			bestCount = cnt
+		}
+	}
+	return best
+}
+
 func (self *DataCoordinator) transferMyNamespaceLeader(nsInfo *PartitionMetaInfo, nid string) {
 	nsNode := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
 	if nsNode == nil {
@@ -420,6 +850,33 @@ func (self *DataCoordinator) checkForUnsyncedNamespaces() {
 
 		// check local namespaces with cluster to remove the unneed data
 		tmpChecks := self.localNSMgr.GetNamespaces()
+		// build a per-namespace, per-zone count of leaders we can currently
+		// observe locally, used to spread leaders across zones below.
+		zoneLeaderCounts := make(map[string]map[string]int)
+		for name := range tmpChecks {
+			namespace, pid := common.GetNamespaceAndPartition(name)
+			if namespace == "" {
+				continue
+			}
+			nsMeta, err := self.register.GetNamespacePartInfo(namespace, pid)
+			if err != nil {
+				continue
+			}
+			leaderRegID := self.getNamespaceRaftLeader(nsMeta)
+			if leaderRegID == 0 {
+				continue
+			}
+			for _, nid := range nsMeta.GetISR() {
+				if ExtractRegIDFromGenID(nid) != leaderRegID {
+					continue
+				}
+				if zoneLeaderCounts[namespace] == nil {
+					zoneLeaderCounts[namespace] = make(map[string]int)
+				}
+				zoneLeaderCounts[namespace][self.zoneOfNode(nid)]++
+				break
+			}
+		}
 		for name, localNamespace := range tmpChecks {
 			namespace, pid := common.GetNamespaceAndPartition(name)
 			if namespace == "" {
@@ -459,72 +916,47 @@ func (self *DataCoordinator) checkForUnsyncedNamespaces() {
 			if leader != self.GetMyRegID() || len(isrList) == 0 {
 				continue
 			}
-			isReplicasEnough := len(isrList) >= namespaceMeta.Replica
+			self.checkLearnerCatchup(namespaceMeta)
+			voterList := self.voterISRList(namespaceMeta)
+			isReplicasEnough := len(voterList) >= namespaceMeta.Replica
+			self.checkUnderReplicatedGrace(namespaceMeta, isReplicasEnough)
+			expectedLeader := self.pickZoneBalancedLeader(namespaceMeta, voterList, zoneLeaderCounts[namespace])
 
-			if isReplicasEnough && isrList[0] != self.GetMyID() {
+			if isReplicasEnough && expectedLeader != self.GetMyID() {
 				// the raft leader check if I am the expected sharding leader,
 				// if not, try to transfer the leader to expected node. We need do this
-				// because we should make all the sharding leaders balanced on
-				// all the cluster nodes.
-				self.transferMyNamespaceLeader(namespaceMeta, isrList[0])
+				// because we should make all the sharding leaders balanced across
+				// zones/racks and across cluster nodes. Learners are never leader
+				// candidates.
+				self.transferMyNamespaceLeader(namespaceMeta, expectedLeader)
 			} else {
 				members := self.getNamespaceRaftMembers(namespaceMeta)
-				// check if any replica is not joined to members
-				anyJoined := false
-				for nid, rid := range namespaceMeta.RaftIDs {
-					found := false
-					for _, m := range members {
-						if m.ID == rid {
-							found = true
-							if m.NodeID != ExtractRegIDFromGenID(nid) {
-								CoordLog().Infof("found raft member %v mismatch the replica node: %v", m, nid)
-							}
-							break
-						}
-					}
-					if !found {
-						anyJoined = true
-						var m common.MemberInfo
-						m.ID = rid
-						m.NodeID = ExtractRegIDFromGenID(nid)
-						m.GroupID = uint64(namespaceMeta.MinGID) + uint64(namespaceMeta.Partition)
-						m.GroupName = namespaceMeta.GetDesp()
-						raddr, err := self.getRaftAddrForNode(nid)
-						if err != nil {
-							CoordLog().Infof("failed to get raft address for node: %v, %v", nid, err)
-						} else {
-							m.RaftURLs = append(m.RaftURLs, raddr)
-							self.addNamespaceRaftMember(namespaceMeta, &m)
-						}
+				adds, removes := self.diffRaftMembers(namespaceMeta, members)
+				if len(adds) > 0 && len(removes) > 0 {
+					// a full replica swap: decommissioning one node while
+					// adding its replacement. Do this as a single joint-consensus
+					// change instead of interleaved add/remove proposals, so the
+					// group never drops below its tolerated failure count
+					// mid-transition.
+					self.changeNamespaceMembersAtomic(namespaceMeta, adds, removes)
+					go self.tryCheckNamespaces()
+					continue
+				}
+				for i := range adds {
+					m := &adds[i]
+					if self.isLearnerRegID(namespaceMeta, m.NodeID) {
+						self.addNamespaceRaftLearner(namespaceMeta, m)
+					} else {
+						self.addNamespaceRaftMember(namespaceMeta, m)
 					}
 				}
-				if anyJoined || len(members) <= namespaceMeta.Replica || !isReplicasEnough {
+				if len(adds) > 0 || len(members) <= namespaceMeta.Replica || !isReplicasEnough {
 					go self.tryCheckNamespaces()
 					continue
 				}
 				// the members is more than replica, we need to remove the member that is not necessary anymore
-				for _, m := range members {
-					found := false
-					for nid, rid := range namespaceMeta.RaftIDs {
-						if m.ID == rid {
-							found = true
-							if m.NodeID != ExtractRegIDFromGenID(nid) {
-								CoordLog().Infof("found raft member %v mismatch the replica node: %v", m, nid)
-							}
-							break
-						}
-					}
-					if !found {
-						CoordLog().Infof("raft member %v not found in meta: %v", m, namespaceMeta.RaftNodes)
-						self.removeNamespaceRaftMember(namespaceMeta, m)
-					} else {
-						for nid, removing := range namespaceMeta.Removings {
-							if m.ID == removing.RemoveReplicaID && m.NodeID == ExtractRegIDFromGenID(nid) {
-								CoordLog().Infof("raft member %v is marked as removing in meta: %v", m, namespaceMeta.Removings)
-								self.removeNamespaceRaftMember(namespaceMeta, m)
-							}
-						}
-					}
+				for i := range removes {
+					self.removeNamespaceRaftMember(namespaceMeta, &removes[i])
 				}
 			}
 		}
@@ -545,6 +977,31 @@ func (self *DataCoordinator) checkForUnsyncedNamespaces() {
 	}
 }
 
+// checkUnderReplicatedGrace tracks how long a namespace partition has been
+// under-replicated and, once it has stayed that way longer than
+// UnderReplicatedGracePeriod, logs a warning naming it as a candidate for
+// the PD to fill from a warm standby node instead of waiting for a normal
+// replica to rejoin. Nothing else is recorded or sent to the PD. The actual promotion of a standby is driven by the PD, which
+// issues PromoteToParticipant on the chosen standby through its own RPC.
+func (self *DataCoordinator) checkUnderReplicatedGrace(nsInfo *PartitionMetaInfo, isReplicasEnough bool) {
+	self.underReplicatedMutex.Lock()
+	defer self.underReplicatedMutex.Unlock()
+	desp := nsInfo.GetDesp()
+	if isReplicasEnough {
+		delete(self.underReplicatedSince, desp)
+		return
+	}
+	since, ok := self.underReplicatedSince[desp]
+	if !ok {
+		self.underReplicatedSince[desp] = time.Now()
+		return
+	}
+	if time.Since(since) > UnderReplicatedGracePeriod {
+		CoordLog().Warningf("namespace %v has been under-replicated for %v, it is a candidate for standby promotion",
+			desp, time.Since(since))
+	}
+}
+
 func (self *DataCoordinator) forceRemoveLocalNamespace(localNamespace *node.NamespaceNode) {
 	err := localNamespace.Destroy()
 	if err != nil {
@@ -617,6 +1074,9 @@ func (self *DataCoordinator) prepareNamespaceConf(nsInfo *PartitionMetaInfo) (*n
 				continue
 			}
 		}
+		if _, ok := nsInfo.LearnerIDs[nid]; ok {
+			rinfo.Learner = true
+		}
 		nsConf.RaftGroupConf.SeedNodes = append(nsConf.RaftGroupConf.SeedNodes, rinfo)
 	}
 	if len(nsConf.RaftGroupConf.SeedNodes) == 0 {
@@ -817,46 +1277,36 @@ func (self *DataCoordinator) GetSnapshotSyncInfo(fullNamespace string) ([]common
 		ssi.RemoteAddr = node.NodeIP
 		ssi.HttpAPIPort = node.HttpPort
 		ssi.RsyncModule = node.RsyncModule
+		ssi.Transports = []string{TransportNativeHTTP, TransportRsync}
+		ssi.PreferredTransport = TransportNativeHTTP
+		if node.RsyncModule == "" {
+			// nothing to fall back to, native-http is the only option
+			ssi.Transports = []string{TransportNativeHTTP}
+		}
 		ssiList = append(ssiList, ssi)
 	}
 	return ssiList, nil
 }
 
-// before shutdown, we transfer the leader to others to reduce
-// the unavailable time.
-func (self *DataCoordinator) prepareLeavingCluster() {
-	CoordLog().Infof("I am prepare leaving the cluster.")
-	allNamespaces, _, _ := self.register.GetAllNamespaces()
-	for _, nsParts := range allNamespaces {
-		for _, nsInfo := range nsParts {
-			if FindSlice(nsInfo.RaftNodes, self.myNode.GetID()) == -1 {
-				continue
-			}
-			localNamespace := self.localNSMgr.GetNamespaceNode(nsInfo.GetDesp())
-			if localNamespace == nil {
-				continue
-			}
-			// only leader check the follower status
-			leader := self.getNamespaceRaftLeader(nsInfo.GetCopy())
-			if leader != self.GetMyRegID() {
-				continue
-			}
-			for _, newLeader := range nsInfo.GetISR() {
-				if newLeader == self.GetMyID() {
-					continue
-				}
-				self.transferMyNamespaceLeader(nsInfo.GetCopy(), newLeader)
-				break
-			}
-		}
+// prepareLeavingCluster is implemented in drain.go: before shutdown, it
+// concurrently transfers leadership for every partition this node leads,
+// with a bounded worker pool, per-partition deadline/retry and a
+// queryable drain report, to reduce unavailable time on nodes with many
+// partitions.
+
+// buildISRStat fills in an ISRStat for one raft node, enriching it with
+// the CRDT-sourced hostname hint (when the CRDT metadata layer is
+// enabled) instead of issuing an extra RPC per node on every stats call.
+// No rack or lag information is filled in.
+func (self *DataCoordinator) buildISRStat(namespace string, partition int, nid string) ISRStat {
+	stat := ISRStat{NodeID: nid}
+	if self.crdt == nil {
+		return stat
 	}
-	CoordLog().Infof("prepare leaving finished.")
-	self.localNSMgr.Stop()
-	if self.register != nil {
-		atomic.StoreInt32(&self.stopping, 1)
-		self.register.Unregister(&self.myNode)
-		self.register.Stop()
+	if host, ok := self.crdt.Get(namespace, partition, "hostname"); ok {
+		stat.HostName = host
 	}
+	return stat
 }
 
 func (self *DataCoordinator) Stats(namespace string, part int) *CoordStats {
@@ -876,7 +1326,7 @@ func (self *DataCoordinator) Stats(namespace string, part int) *CoordStats {
 				stat.Name = namespace
 				stat.Partition = part
 				for _, nid := range nsInfo.RaftNodes {
-					stat.ISRStats = append(stat.ISRStats, ISRStat{HostName: "", NodeID: nid})
+					stat.ISRStats = append(stat.ISRStats, self.buildISRStat(namespace, stat.Partition, nid))
 				}
 				s.NsCoordStats = append(s.NsCoordStats, stat)
 			}
@@ -890,11 +1340,11 @@ func (self *DataCoordinator) Stats(namespace string, part int) *CoordStats {
 				stat.Name = namespace
 				stat.Partition = nsInfo.Partition
 				for _, nid := range nsInfo.RaftNodes {
-					stat.ISRStats = append(stat.ISRStats, ISRStat{HostName: "", NodeID: nid})
+					stat.ISRStats = append(stat.ISRStats, self.buildISRStat(namespace, stat.Partition, nid))
 				}
 				s.NsCoordStats = append(s.NsCoordStats, stat)
 			}
 		}
 	}
 	return s
-}
\ No newline at end of file
+}
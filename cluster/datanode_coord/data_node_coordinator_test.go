@@ -0,0 +1,79 @@
+package datanode_coord
+
+import (
+	"testing"
+
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+	"github.com/absolute8511/ZanRedisDB/node"
+)
+
+func newTestCoordinator(t *testing.T, myID string, reg *fakeRegister) *DataCoordinator {
+	t.Helper()
+	coord := NewDataCoordinator("test-cluster", &NodeInfo{ID: myID}, node.NewNamespaceMgr())
+	coord.register = reg
+	return coord
+}
+
+func TestDiffRaftMembersAddsMissingAndRemovesStale(t *testing.T) {
+	reg := newFakeRegister()
+	reg.addNode(NodeInfo{ID: "node-b", RaftTransportAddr: "127.0.0.1:8000"})
+	coord := newTestCoordinator(t, "node-a", reg)
+
+	nsInfo := &PartitionMetaInfo{
+		Name:      "test-ns",
+		Partition: 0,
+		MinGID:    100,
+		RaftIDs: map[string]uint64{
+			"node-b": 2,
+		},
+		Removings: map[string]RemovingInfo{},
+	}
+
+	// current raft members only has an unrelated member (id 99), so node-b
+	// (id 2) should be proposed as an add, and the stale member (id 99)
+	// should be proposed as a remove.
+	current := []*common.MemberInfo{
+		{ID: 99, NodeID: ExtractRegIDFromGenID("node-c")},
+	}
+
+	adds, removes := coord.diffRaftMembers(nsInfo, current)
+
+	if len(adds) != 1 || adds[0].ID != 2 {
+		t.Fatalf("expected one add for raft id 2, got %+v", adds)
+	}
+	if len(adds[0].RaftURLs) != 1 || adds[0].RaftURLs[0] != "127.0.0.1:8000" {
+		t.Fatalf("expected add to carry node-b's raft address, got %+v", adds[0])
+	}
+	if len(removes) != 1 || removes[0].ID != 99 {
+		t.Fatalf("expected one remove for stale member id 99, got %+v", removes)
+	}
+}
+
+func TestDiffRaftMembersRemovesMarkedForRemoval(t *testing.T) {
+	reg := newFakeRegister()
+	reg.addNode(NodeInfo{ID: "node-b", RaftTransportAddr: "127.0.0.1:8000"})
+	coord := newTestCoordinator(t, "node-a", reg)
+
+	nsInfo := &PartitionMetaInfo{
+		Name:      "test-ns",
+		Partition: 0,
+		RaftIDs: map[string]uint64{
+			"node-b": 2,
+		},
+		Removings: map[string]RemovingInfo{
+			"node-b": {RemoveReplicaID: 2},
+		},
+	}
+	current := []*common.MemberInfo{
+		{ID: 2, NodeID: ExtractRegIDFromGenID("node-b")},
+	}
+
+	adds, removes := coord.diffRaftMembers(nsInfo, current)
+	if len(adds) != 0 {
+		t.Fatalf("expected no adds, got %+v", adds)
+	}
+	if len(removes) != 1 || removes[0].ID != 2 {
+		t.Fatalf("expected the removing-marked member to be proposed for removal, got %+v", removes)
+	}
+}
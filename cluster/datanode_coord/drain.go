@@ -0,0 +1,319 @@
+package datanode_coord
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+// DefaultDrainConcurrency bounds how many partitions are drained at once;
+// operators with hundreds of partitions on one node need this to be more
+// than "one at a time" for the "reduce unavailable time" goal to hold.
+var DefaultDrainConcurrency = runtime.NumCPU()
+
+// DefaultDrainPartitionDeadline bounds how long a single partition's
+// leader transfer is allowed to take (including retries) before it is
+// reported as stuck and the drain moves on.
+var DefaultDrainPartitionDeadline = time.Second * 30
+
+// DefaultDrainMaxRetries is how many leader transfer attempts are made for
+// a partition in total (with exponential backoff between them) before
+// giving up on it.
+var DefaultDrainMaxRetries = 3
+
+// DrainPartitionResult is the outcome for one partition in a drain report.
+type DrainPartitionResult struct {
+	Namespace string
+	Partition int
+	Succeeded bool
+	Reason    string
+	Attempts  int
+	Duration  time.Duration
+}
+
+// DrainReport is published while prepareLeavingCluster runs, and remains
+// readable after it finishes, so an operator (or the PD) can see progress
+// and which partitions got stuck.
+type DrainReport struct {
+	mutex      sync.Mutex
+	Total      int
+	Succeeded  int
+	Failed     int
+	InFlight   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	avgLatency time.Duration
+	completed  int
+	Results    []DrainPartitionResult
+}
+
+func newDrainReport(total int) *DrainReport {
+	return &DrainReport{Total: total, StartedAt: time.Now()}
+}
+
+func (r *DrainReport) startOne() {
+	r.mutex.Lock()
+	r.InFlight++
+	r.mutex.Unlock()
+}
+
+func (r *DrainReport) finishOne(res DrainPartitionResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.InFlight--
+	r.completed++
+	if res.Succeeded {
+		r.Succeeded++
+	} else {
+		r.Failed++
+	}
+	// exponential moving average (each new sample weighted 1/2) so ETA has
+	// some signal without keeping full history.
+	if r.avgLatency == 0 {
+		r.avgLatency = res.Duration
+	} else {
+		r.avgLatency = (r.avgLatency + res.Duration) / 2
+	}
+	r.Results = append(r.Results, res)
+}
+
+// DrainReportSnapshot is a read-only, copyable view of a DrainReport: every
+// field except its mutex, so callers can pass it around and copy it freely
+// without copying the lock.
+type DrainReportSnapshot struct {
+	Total      int
+	Succeeded  int
+	Failed     int
+	InFlight   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	avgLatency time.Duration
+	completed  int
+	// ETA is how much longer the drain is expected to take, based on the
+	// moving-average transfer latency observed so far at
+	// DefaultDrainConcurrency; zero once nothing remains or no partition
+	// has finished yet.
+	ETA     time.Duration
+	Results []DrainPartitionResult
+}
+
+// Snapshot returns a read-only copy of the report, including an ETA for
+// the remaining partitions based on the moving-average transfer latency
+// observed so far.
+func (r *DrainReport) Snapshot() DrainReportSnapshot {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return DrainReportSnapshot{
+		Total:      r.Total,
+		Succeeded:  r.Succeeded,
+		Failed:     r.Failed,
+		InFlight:   r.InFlight,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		avgLatency: r.avgLatency,
+		completed:  r.completed,
+		ETA:        r.etaLocked(DefaultDrainConcurrency),
+		Results:    append([]DrainPartitionResult{}, r.Results...),
+	}
+}
+
+func (r *DrainReport) eta(concurrency int) time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.etaLocked(concurrency)
+}
+
+// etaLocked is eta's logic without taking the lock, for callers (like
+// Snapshot) that already hold it.
+func (r *DrainReport) etaLocked(concurrency int) time.Duration {
+	remaining := r.Total - r.completed
+	if remaining <= 0 || r.avgLatency == 0 || concurrency <= 0 {
+		return 0
+	}
+	batches := (remaining + concurrency - 1) / concurrency
+	return time.Duration(batches) * r.avgLatency
+}
+
+// drainPartitionJob is one unit of work for the drain worker pool: a
+// namespace partition this node is leader for and must hand off.
+type drainPartitionJob struct {
+	nsInfo *PartitionMetaInfo
+}
+
+// prepareLeavingCluster runs a bounded-worker-pool drain that transfers
+// leadership for every partition this node leads, then unregisters the
+// node; it blocks until the drain and unregister finish. Call
+// GetDrainReport from another goroutine to poll progress while it runs,
+// and CancelDrain to abort early (e.g. from an admin HTTP endpoint).
+func (self *DataCoordinator) prepareLeavingCluster() {
+	CoordLog().Infof("event=drain_start node=%v", self.GetMyID())
+	allNamespaces, _, _ := self.register.GetAllNamespaces()
+
+	var jobs []drainPartitionJob
+	for _, nsParts := range allNamespaces {
+		for _, nsInfo := range nsParts {
+			info := nsInfo
+			if FindSlice(info.RaftNodes, self.myNode.GetID()) == -1 {
+				continue
+			}
+			localNamespace := self.localNSMgr.GetNamespaceNode(info.GetDesp())
+			if localNamespace == nil {
+				continue
+			}
+			leader := self.getNamespaceRaftLeader(info.GetCopy())
+			if leader != self.GetMyRegID() {
+				continue
+			}
+			jobs = append(jobs, drainPartitionJob{nsInfo: info.GetCopy()})
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	self.drainMutex.Lock()
+	self.drainCancel = cancel
+	self.drainReport = newDrainReport(len(jobs))
+	report := self.drainReport
+	self.drainMutex.Unlock()
+
+	concurrency := DefaultDrainConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	jobC := make(chan drainPartitionJob)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobC {
+				self.drainOnePartition(ctx, job, report)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		select {
+		case <-ctx.Done():
+			CoordLog().Infof("event=drain_cancelled node=%v remaining=%v", self.GetMyID(), len(jobs)-report.Snapshot().completed)
+		case jobC <- job:
+			continue
+		}
+	}
+	close(jobC)
+	wg.Wait()
+
+	self.drainMutex.Lock()
+	report.FinishedAt = time.Now()
+	self.drainMutex.Unlock()
+
+	final := report.Snapshot()
+	CoordLog().Infof("event=drain_finished node=%v total=%v succeeded=%v failed=%v dur=%v",
+		self.GetMyID(), final.Total, final.Succeeded, final.Failed, final.FinishedAt.Sub(final.StartedAt))
+	if final.Failed > 0 {
+		for _, r := range final.Results {
+			if !r.Succeeded {
+				CoordLog().Warningf("event=drain_partition_stuck namespace=%v partition=%v reason=%v attempts=%v",
+					r.Namespace, r.Partition, r.Reason, r.Attempts)
+			}
+		}
+	}
+
+	// proceed to unregister even if some partitions never transferred, the
+	// report above is how an operator finds out they need to act.
+	self.localNSMgr.Stop()
+	if self.register != nil {
+		atomic.StoreInt32(&self.stopping, 1)
+		self.register.Unregister(&self.myNode)
+		self.register.Stop()
+	}
+}
+
+// drainOnePartition transfers leadership for one partition with a
+// per-partition deadline and exponential backoff retries, recording the
+// outcome (success or exhausted retries) into the shared report as one
+// structured log line per partition.
+func (self *DataCoordinator) drainOnePartition(ctx context.Context, job drainPartitionJob, report *DrainReport) {
+	report.startOne()
+	start := time.Now()
+	nsInfo := job.nsInfo
+	deadlineCtx, cancel := context.WithTimeout(ctx, DefaultDrainPartitionDeadline)
+	defer cancel()
+
+	var lastErr string
+	succeeded := false
+	attempt := 0
+	backoff := time.Millisecond * 100
+loop:
+	for attempt = 1; attempt <= DefaultDrainMaxRetries; attempt++ {
+		select {
+		case <-deadlineCtx.Done():
+			lastErr = deadlineCtx.Err().Error()
+			break loop
+		default:
+		}
+		newLeader := self.pickLeastLoadedISRMember(nsInfo, nsInfo.PlacementSpec)
+		if newLeader == "" {
+			lastErr = "no other ISR member available"
+			break loop
+		}
+		self.transferMyNamespaceLeader(nsInfo, newLeader)
+		if self.getNamespaceRaftLeader(nsInfo) != self.GetMyRegID() {
+			succeeded = true
+			break loop
+		}
+		lastErr = fmt.Sprintf("leader transfer to %v did not take effect", newLeader)
+		select {
+		case <-deadlineCtx.Done():
+			break loop
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if attempt > DefaultDrainMaxRetries {
+		// the loop exits with attempt one past the last attempt made
+		attempt = DefaultDrainMaxRetries
+	}
+	res := DrainPartitionResult{
+		Namespace: nsInfo.Name,
+		Partition: nsInfo.Partition,
+		Succeeded: succeeded,
+		Reason:    lastErr,
+		Attempts:  attempt,
+		Duration:  time.Since(start),
+	}
+	report.finishOne(res)
+	CoordLog().Infof("event=drain_partition namespace=%v partition=%v succeeded=%v attempts=%v dur=%v reason=%v",
+		res.Namespace, res.Partition, res.Succeeded, res.Attempts, res.Duration, res.Reason)
+}
+
+// GetDrainReport returns the current (or most recently finished) drain
+// report, or nil if no drain has ever run on this node. The ETA is
+// computed fresh from the moving-average transfer latency observed so
+// far.
+func (self *DataCoordinator) GetDrainReport() *DrainReportSnapshot {
+	self.drainMutex.Lock()
+	report := self.drainReport
+	self.drainMutex.Unlock()
+	if report == nil {
+		return nil
+	}
+	snap := report.Snapshot()
+	return &snap
+}
+
+// CancelDrain aborts an in-flight prepareLeavingCluster drain, e.g. from an
+// admin HTTP endpoint when an operator needs to interrupt a node leaving
+// the cluster. In-flight partitions finish their current attempt; queued
+// partitions are skipped.
+func (self *DataCoordinator) CancelDrain() {
+	self.drainMutex.Lock()
+	cancel := self.drainCancel
+	self.drainMutex.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
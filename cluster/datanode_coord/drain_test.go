@@ -0,0 +1,45 @@
+package datanode_coord
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDrainReportETAZeroBeforeAnyCompletion(t *testing.T) {
+	r := newDrainReport(4)
+	if got := r.eta(2); got != 0 {
+		t.Fatalf("expected 0 ETA with no completed partitions yet, got %v", got)
+	}
+}
+
+func TestDrainReportETAScalesWithRemainingBatches(t *testing.T) {
+	r := newDrainReport(4)
+	r.finishOne(DrainPartitionResult{Succeeded: true, Duration: time.Second})
+
+	// 3 remaining at concurrency 2 is 2 batches of average latency 1s.
+	got := r.eta(2)
+	want := 2 * time.Second
+	if got != want {
+		t.Fatalf("expected ETA %v for 3 remaining at concurrency 2, got %v", want, got)
+	}
+}
+
+func TestDrainReportETAZeroWhenFinished(t *testing.T) {
+	r := newDrainReport(1)
+	r.finishOne(DrainPartitionResult{Succeeded: true, Duration: time.Second})
+	if got := r.eta(2); got != 0 {
+		t.Fatalf("expected 0 ETA once every partition has completed, got %v", got)
+	}
+}
+
+func TestDrainReportSnapshotDoesNotShareResultsSlice(t *testing.T) {
+	r := newDrainReport(1)
+	r.finishOne(DrainPartitionResult{Namespace: "ns", Succeeded: true})
+
+	snap := r.Snapshot()
+	snap.Results[0].Namespace = "mutated"
+
+	if r.Results[0].Namespace != "ns" {
+		t.Fatalf("expected Snapshot to copy Results, mutation leaked back into the report: %v", r.Results[0].Namespace)
+	}
+}
@@ -0,0 +1,56 @@
+package datanode_coord
+
+import (
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+// fakeRegister is a minimal in-memory DataNodeRegister used across this
+// package's tests to exercise coordinator logic without a real etcd-backed
+// register.
+type fakeRegister struct {
+	nodes map[string]NodeInfo
+}
+
+func newFakeRegister() *fakeRegister {
+	return &fakeRegister{nodes: make(map[string]NodeInfo)}
+}
+
+func (f *fakeRegister) addNode(n NodeInfo) {
+	f.nodes[n.GetID()] = n
+}
+
+func (f *fakeRegister) InitClusterID(clusterID string)      {}
+func (f *fakeRegister) NewRegisterNodeID() (uint64, error)  { return 0, nil }
+func (f *fakeRegister) Register(nodeInfo *NodeInfo) error   { return nil }
+func (f *fakeRegister) Unregister(nodeInfo *NodeInfo) error { return nil }
+func (f *fakeRegister) Stop()                               {}
+func (f *fakeRegister) WatchPDLeader(leaderChan chan *NodeInfo, stop chan struct{}) error {
+	return nil
+}
+func (f *fakeRegister) GetAllPDNodes() ([]NodeInfo, error)     { return nil, nil }
+func (f *fakeRegister) GetNamespacesNotifyChan() chan struct{} { return make(chan struct{}) }
+func (f *fakeRegister) GetAllNamespaces() (map[string]map[int]PartitionMetaInfo, int64, error) {
+	return nil, 0, nil
+}
+func (f *fakeRegister) GetNamespaceMetaInfo(namespace string) (PartitionMetaInfo, error) {
+	return PartitionMetaInfo{}, nil
+}
+func (f *fakeRegister) GetNamespacePartInfo(namespace string, partition int) (*PartitionMetaInfo, error) {
+	return nil, ErrKeyNotFound
+}
+
+func (f *fakeRegister) GetNodeInfo(nid string) (NodeInfo, error) {
+	n, ok := f.nodes[nid]
+	if !ok {
+		return NodeInfo{}, ErrKeyNotFound
+	}
+	return n, nil
+}
+
+func (f *fakeRegister) GetAllDataNodes() (map[string]NodeInfo, error) {
+	cp := make(map[string]NodeInfo, len(f.nodes))
+	for k, v := range f.nodes {
+		cp[k] = v
+	}
+	return cp, nil
+}
@@ -0,0 +1,192 @@
+package datanode_coord
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+// MembershipBackend abstracts the cluster membership/metadata store behind
+// a smaller interface than the etcd-flavored DataNodeRegister semantics
+// (WatchPDLeader, GetNamespacesNotifyChan, NewRegisterNodeID,
+// ErrKeyNotFound, ...). DataCoordinator uses it only to follow namespace
+// metadata changes (see watchMembershipChanges); registration, namespace
+// and node lookups still go through DataNodeRegister, which stays
+// required. Implementations must expose monotonic revisions so callers such as
+// checkForUnsyncedNamespaces can drive off a real change stream instead of
+// polling on a fixed timer.
+type MembershipBackend interface {
+	// WatchLeader streams PD leader changes until stop is closed.
+	WatchLeader(leaderChan chan *NodeInfo, stop chan struct{})
+	// WatchNamespaces blocks until there is a namespace metadata change
+	// with a revision greater than sinceRev, then returns the new
+	// revision. Implementations should return promptly on stop.
+	WatchNamespaces(sinceRev int64, stop chan struct{}) (int64, error)
+	// CompareAndSetPartitionMeta atomically updates a partition's metadata
+	// iff its current revision equals expectedRev, returning the new
+	// revision on success.
+	CompareAndSetPartitionMeta(namespace string, partition int, expectedRev int64, meta *PartitionMetaInfo) (int64, error)
+	// LeaseKeepAlive renews this node's registration lease with the
+	// backend so it is not considered dead.
+	LeaseKeepAlive(nodeID string) error
+}
+
+// etcdMembershipBackend adapts the existing etcd-based DataNodeRegister to
+// the MembershipBackend interface, so existing deployments keep working
+// unchanged while new code can be written against the smaller interface.
+type etcdMembershipBackend struct {
+	register DataNodeRegister
+}
+
+// NewEtcdMembershipBackend wraps an existing etcd-flavored register as a
+// MembershipBackend.
+func NewEtcdMembershipBackend(register DataNodeRegister) MembershipBackend {
+	return &etcdMembershipBackend{register: register}
+}
+
+func (b *etcdMembershipBackend) WatchLeader(leaderChan chan *NodeInfo, stop chan struct{}) {
+	b.register.WatchPDLeader(leaderChan, stop)
+}
+
+func (b *etcdMembershipBackend) WatchNamespaces(sinceRev int64, stop chan struct{}) (int64, error) {
+	notifyChan := b.register.GetNamespacesNotifyChan()
+	select {
+	case <-stop:
+		return sinceRev, nil
+	case <-notifyChan:
+		// the etcd register does not expose a real revision, so we just
+		// bump a local counter to signal "something changed".
+		return sinceRev + 1, nil
+	}
+}
+
+func (b *etcdMembershipBackend) CompareAndSetPartitionMeta(namespace string, partition int, expectedRev int64, meta *PartitionMetaInfo) (int64, error) {
+	return 0, errors.New("CompareAndSetPartitionMeta is not supported by the etcd membership backend from the data node side")
+}
+
+func (b *etcdMembershipBackend) LeaseKeepAlive(nodeID string) error {
+	// the etcd register already keeps its own lease alive internally via
+	// Register/WatchPDLeader, nothing extra to do here.
+	return nil
+}
+
+// singleNodeMembershipBackend is NOT the "embedded hashicorp-raft PD that
+// eliminates the etcd dependency" this package's callers may be tempted to
+// reach for it as: it is a plain in-memory map guarded by a mutex, with no
+// persistence and no replication across nodes. Every write is lost on
+// restart and it is only ever consistent for a single process talking to
+// itself, which makes it unsuitable for any multi-node deployment,
+// embedded or not. Its only legitimate use is letting DataCoordinator be
+// coded against the smaller MembershipBackend interface, and in tests.
+// Actually dropping the etcd dependency for small deployments still
+// requires a real replicated log (e.g. hashicorp/raft) behind this
+// interface; that work has not been done here.
+type singleNodeMembershipBackend struct {
+	mutex       sync.Mutex
+	rev         int64
+	partitions  map[string]*PartitionMetaInfo
+	changeChans []chan struct{}
+}
+
+// NewSingleNodeMembershipBackend creates a singleNodeMembershipBackend. See
+// the type's doc comment: this is a single-process stub, not a deployable
+// replacement for an external etcd.
+func NewSingleNodeMembershipBackend() MembershipBackend {
+	return &singleNodeMembershipBackend{
+		partitions: make(map[string]*PartitionMetaInfo),
+	}
+}
+
+func (b *singleNodeMembershipBackend) WatchLeader(leaderChan chan *NodeInfo, stop chan struct{}) {
+	// a single embedded node is trivially its own leader until a real
+	// raft group backs this backend.
+	<-stop
+}
+
+func (b *singleNodeMembershipBackend) WatchNamespaces(sinceRev int64, stop chan struct{}) (int64, error) {
+	b.mutex.Lock()
+	if b.rev > sinceRev {
+		cur := b.rev
+		b.mutex.Unlock()
+		return cur, nil
+	}
+	ch := make(chan struct{}, 1)
+	b.changeChans = append(b.changeChans, ch)
+	b.mutex.Unlock()
+	select {
+	case <-stop:
+		return sinceRev, nil
+	case <-ch:
+		b.mutex.Lock()
+		cur := b.rev
+		b.mutex.Unlock()
+		return cur, nil
+	case <-time.After(time.Minute * 10):
+		return sinceRev, nil
+	}
+}
+
+// CompareAndSetPartitionMeta compares expectedRev against the backend-wide
+// revision rather than a per-partition one, and an expectedRev of 0 writes
+// unconditionally.
+func (b *singleNodeMembershipBackend) CompareAndSetPartitionMeta(namespace string, partition int, expectedRev int64, meta *PartitionMetaInfo) (int64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if expectedRev != 0 && expectedRev != b.rev {
+		return b.rev, errors.New("partition meta revision mismatch")
+	}
+	key := GetNamespacePartitionFileName(namespace, partition, "")
+	b.partitions[key] = meta
+	b.rev++
+	for _, ch := range b.changeChans {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	b.changeChans = nil
+	return b.rev, nil
+}
+
+func (b *singleNodeMembershipBackend) LeaseKeepAlive(nodeID string) error {
+	return nil
+}
+
+// MigrateEtcdToSingleNode dumps all namespace partition metadata known to
+// an etcd-backed register into a fresh singleNodeMembershipBackend, for
+// testing against a copy of real cluster state. It is not a path to
+// dropping etcd in production: the destination backend does not persist
+// or replicate, so this is an offline copy into a throwaway stub, not a
+// cutover. As with rqlite's v5 migration notes, the two consensus
+// implementations are not wire-compatible, so there is no live migration
+// path either way.
+func MigrateEtcdToSingleNode(etcdRegister DataNodeRegister, dest MembershipBackend) error {
+	eb, ok := dest.(*singleNodeMembershipBackend)
+	if !ok {
+		return errors.New("MigrateEtcdToSingleNode only supports migrating into a singleNodeMembershipBackend")
+	}
+	namespaces, _, err := etcdRegister.GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	for _, parts := range namespaces {
+		for partition, meta := range parts {
+			m := meta
+			if _, err := eb.CompareAndSetPartitionMeta(meta.Name, partition, 0, &m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetMembershipBackend lets operators drive the coordinator off the smaller
+// MembershipBackend interface instead of, or alongside, the etcd register.
+// When set before Start, watchMembershipChanges follows the backend's
+// change stream and triggers checkForUnsyncedNamespaces on each new
+// revision, in addition to its 10-minute polling ticker.
+func (self *DataCoordinator) SetMembershipBackend(backend MembershipBackend) {
+	self.membership = backend
+}
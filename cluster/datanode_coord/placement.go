@@ -0,0 +1,206 @@
+package datanode_coord
+
+import (
+	"math"
+	"sort"
+
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+// AffinityRule, SpreadTarget and PlacementSpec live in the cluster package
+// (see cluster.PlacementSpec) since PartitionMetaInfo.PlacementSpec needs
+// to reference them as a field type; they're in scope here via the
+// package's dot-import.
+
+// CandidateScore is one node's score breakdown for a placement decision,
+// returned by dry-run so operators can verify a plan before applying it.
+type CandidateScore struct {
+	NodeID        string
+	AffinityScore float64
+	SpreadScore   float64
+	TotalScore    float64
+	Eliminated    bool
+	EliminatedWhy string
+}
+
+// PlacementPlan is the proposed outcome of (re)evaluating placement for a
+// namespace partition: the ranked candidates and which ones were picked.
+type PlacementPlan struct {
+	Namespace  string
+	Partition  int
+	Candidates []CandidateScore
+	Picked     []string
+}
+
+// nodeAttribute reads one labeled attribute off a node, falling back to the
+// well-known Zone/Rack fields for those two attribute names so existing
+// zone-aware code and the more general placement engine share one source
+// of truth.
+func nodeAttribute(n *NodeInfo, attribute string) string {
+	switch attribute {
+	case "zone":
+		return n.Zone
+	case "rack":
+		return n.Rack
+	}
+	if n.Attributes == nil {
+		return ""
+	}
+	return n.Attributes[attribute]
+}
+
+// scoreCandidate applies hard constraints, weighted affinities and spread
+// targets to one candidate node and returns its score breakdown.
+func (self *DataCoordinator) scoreCandidate(nid string, spec *PlacementSpec, currentPicks []string) CandidateScore {
+	cs := CandidateScore{NodeID: nid}
+	ninfo, err := self.register.GetNodeInfo(nid)
+	if err != nil {
+		cs.Eliminated = true
+		cs.EliminatedWhy = "node info unavailable"
+		return cs
+	}
+	for attr, want := range spec.HardConstraints {
+		if nodeAttribute(&ninfo, attr) != want {
+			cs.Eliminated = true
+			cs.EliminatedWhy = "hard constraint " + attr + "=" + want + " not satisfied"
+			return cs
+		}
+	}
+	for _, rule := range spec.Affinities {
+		match := 0.0
+		if nodeAttribute(&ninfo, rule.Attribute) == rule.Value {
+			match = 1.0
+		}
+		cs.AffinityScore += rule.Weight * match
+	}
+	for _, target := range spec.Spreads {
+		value := nodeAttribute(&ninfo, target.Attribute)
+		counts := make(map[string]int)
+		for _, picked := range currentPicks {
+			pinfo, err := self.register.GetNodeInfo(picked)
+			if err != nil {
+				continue
+			}
+			counts[nodeAttribute(&pinfo, target.Attribute)]++
+		}
+		total := len(currentPicks) + 1
+		counts[value]++
+		actualPct := float64(counts[value]) / float64(total)
+		wantPct := target.TargetPercent[value]
+		// lower deviation from target distribution scores higher
+		cs.SpreadScore -= math.Abs(actualPct - wantPct)
+	}
+	cs.TotalScore = cs.AffinityScore + cs.SpreadScore
+	return cs
+}
+
+// PlanPlacement returns the proposed ISR assignment (and its score
+// breakdown) for a namespace partition under the given placement spec,
+// without applying any change -- useful for operators to verify a plan
+// before it takes effect.
+func (self *DataCoordinator) PlanPlacement(nsInfo *PartitionMetaInfo, candidates []string, spec *PlacementSpec, need int) *PlacementPlan {
+	plan := &PlacementPlan{Namespace: nsInfo.Name, Partition: nsInfo.Partition}
+	var picked []string
+	remaining := make([]string, len(candidates))
+	copy(remaining, candidates)
+	for len(picked) < need && len(remaining) > 0 {
+		scored := make([]CandidateScore, 0, len(remaining))
+		for _, nid := range remaining {
+			scored = append(scored, self.scoreCandidate(nid, spec, picked))
+		}
+		sort.SliceStable(scored, func(i, j int) bool {
+			if scored[i].Eliminated != scored[j].Eliminated {
+				return !scored[i].Eliminated
+			}
+			if scored[i].TotalScore != scored[j].TotalScore {
+				return scored[i].TotalScore > scored[j].TotalScore
+			}
+			return scored[i].NodeID < scored[j].NodeID
+		})
+		best := scored[0]
+		plan.Candidates = append(plan.Candidates, scored...)
+		if best.Eliminated {
+			break
+		}
+		picked = append(picked, best.NodeID)
+		remaining = removeFromSlice(remaining, best.NodeID)
+	}
+	plan.Picked = picked
+	return plan
+}
+
+func removeFromSlice(s []string, v string) []string {
+	out := make([]string, 0, len(s))
+	for _, item := range s {
+		if item != v {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// Rebalance computes a placement plan for one namespace partition against
+// every data node currently registered in the cluster, not just the ones
+// it already holds a replica on, so it can actually react to a node
+// joining or leaving rather than only reordering the existing ISR. It can
+// serve a manual "rebalance" RPC or a re-evaluation after a node joins or
+// leaves; nothing in this package calls it on those events itself. It
+// never applies anything itself, it only returns the
+// proposed plan so the PD (or an operator inspecting the dry-run output)
+// can decide whether to act on it through the normal add/remove-member
+// path.
+func (self *DataCoordinator) Rebalance(namespace string, partition int, spec *PlacementSpec) (*PlacementPlan, error) {
+	nsInfo, err := self.register.GetNamespacePartInfo(namespace, partition)
+	if err != nil {
+		return nil, err
+	}
+	candidates := append([]string{}, nsInfo.RaftNodes...)
+	allNodes, err := self.register.GetAllDataNodes()
+	if err != nil {
+		// fall back to re-scoring the existing replica set rather than
+		// failing the whole rebalance if the cluster-wide listing is
+		// unavailable.
+		CoordLog().Warningf("rebalance: listing all data nodes failed, falling back to existing replicas of %v: %v",
+			nsInfo.GetDesp(), err)
+	} else {
+		for nid := range allNodes {
+			if FindSlice(candidates, nid) == -1 {
+				candidates = append(candidates, nid)
+			}
+		}
+	}
+	if spec == nil {
+		spec = nsInfo.PlacementSpec
+	}
+	if spec == nil {
+		spec = &PlacementSpec{}
+	}
+	return self.PlanPlacement(nsInfo, candidates, spec, nsInfo.Replica), nil
+}
+
+// pickBestISRMember ranks the current ISR under a placement spec and
+// returns the highest-scoring member, excluding ourselves. This replaces
+// picking the first other ISR member found when transferring leadership
+// during a drain, so the node we hand off to is the best placement choice
+// rather than an arbitrary one.
+func (self *DataCoordinator) pickBestISRMember(nsInfo *PartitionMetaInfo, spec *PlacementSpec) string {
+	isr := nsInfo.GetISR()
+	var candidates []string
+	for _, nid := range isr {
+		if nid == self.GetMyID() {
+			continue
+		}
+		candidates = append(candidates, nid)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	if spec == nil {
+		spec = &PlacementSpec{}
+	}
+	plan := self.PlanPlacement(nsInfo, candidates, spec, 1)
+	if len(plan.Picked) == 0 {
+		return candidates[0]
+	}
+	return plan.Picked[0]
+}
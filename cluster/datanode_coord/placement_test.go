@@ -0,0 +1,66 @@
+package datanode_coord
+
+import (
+	"testing"
+
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+)
+
+func TestScoreCandidateEliminatesOnHardConstraint(t *testing.T) {
+	reg := newFakeRegister()
+	reg.addNode(NodeInfo{ID: "node-a", Zone: "zone-1"})
+	coord := newTestCoordinator(t, "node-a", reg)
+
+	spec := &PlacementSpec{HardConstraints: map[string]string{"zone": "zone-2"}}
+	cs := coord.scoreCandidate("node-a", spec, nil)
+
+	if !cs.Eliminated {
+		t.Fatalf("expected node-a to be eliminated for not matching zone-2, got %+v", cs)
+	}
+}
+
+func TestScoreCandidateAffinityPrefersMatchingAttribute(t *testing.T) {
+	reg := newFakeRegister()
+	reg.addNode(NodeInfo{ID: "node-a", Zone: "zone-1"})
+	reg.addNode(NodeInfo{ID: "node-b", Zone: "zone-2"})
+	coord := newTestCoordinator(t, "node-a", reg)
+
+	spec := &PlacementSpec{
+		Affinities: []AffinityRule{{Attribute: "zone", Value: "zone-1", Weight: 1.0}},
+	}
+	match := coord.scoreCandidate("node-a", spec, nil)
+	noMatch := coord.scoreCandidate("node-b", spec, nil)
+
+	if match.TotalScore <= noMatch.TotalScore {
+		t.Fatalf("expected node-a (zone-1 match) to outscore node-b, got %+v vs %+v", match, noMatch)
+	}
+}
+
+func TestPlanPlacementPicksRequestedCount(t *testing.T) {
+	reg := newFakeRegister()
+	reg.addNode(NodeInfo{ID: "node-a", Zone: "zone-1"})
+	reg.addNode(NodeInfo{ID: "node-b", Zone: "zone-2"})
+	reg.addNode(NodeInfo{ID: "node-c", Zone: "zone-3"})
+	coord := newTestCoordinator(t, "node-a", reg)
+
+	nsInfo := &PartitionMetaInfo{Name: "test-ns", Partition: 0}
+	plan := coord.PlanPlacement(nsInfo, []string{"node-a", "node-b", "node-c"}, &PlacementSpec{}, 2)
+
+	if len(plan.Picked) != 2 {
+		t.Fatalf("expected 2 picked candidates, got %v: %+v", len(plan.Picked), plan.Picked)
+	}
+}
+
+func TestPlanPlacementStopsWhenCandidatesEliminated(t *testing.T) {
+	reg := newFakeRegister()
+	reg.addNode(NodeInfo{ID: "node-a", Zone: "zone-1"})
+	coord := newTestCoordinator(t, "node-a", reg)
+
+	nsInfo := &PartitionMetaInfo{Name: "test-ns", Partition: 0}
+	spec := &PlacementSpec{HardConstraints: map[string]string{"zone": "zone-nowhere"}}
+	plan := coord.PlanPlacement(nsInfo, []string{"node-a"}, spec, 1)
+
+	if len(plan.Picked) != 0 {
+		t.Fatalf("expected no picks when the only candidate is eliminated, got %+v", plan.Picked)
+	}
+}
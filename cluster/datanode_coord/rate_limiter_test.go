@@ -0,0 +1,21 @@
+package datanode_coord
+
+import "testing"
+
+func TestRateLimiterDisabledWhenZero(t *testing.T) {
+	r := newRateLimiter(0)
+	// throttle must be a no-op (not sleep) when bytesPerSec is <= 0.
+	r.throttle(1 << 30)
+}
+
+func TestRateLimiterTracksUsageWithinWindow(t *testing.T) {
+	r := newRateLimiter(1024)
+	r.throttle(512)
+	if r.used != 512 {
+		t.Fatalf("expected used=512 after one throttle call within the window, got %v", r.used)
+	}
+	r.throttle(256)
+	if r.used != 768 {
+		t.Fatalf("expected used to accumulate to 768, got %v", r.used)
+	}
+}
@@ -0,0 +1,305 @@
+package datanode_coord
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/absolute8511/ZanRedisDB/cluster"
+	"github.com/absolute8511/ZanRedisDB/common"
+	node "github.com/absolute8511/ZanRedisDB/node"
+)
+
+const (
+	// snapshotChunkSize is the size of a single resumable transfer chunk.
+	snapshotChunkSize = 4 * 1024 * 1024
+	snapshotTmpSuffix = ".snap.tmp"
+)
+
+// SnapshotTransferRateLimitBytesPerSec throttles how fast a snapshot is
+// pulled from a peer so a multi-GB partition catchup does not saturate the
+// network. Zero disables throttling.
+var SnapshotTransferRateLimitBytesPerSec int64 = 0
+
+// SnapshotTransferProgress is exposed through the coordinator so the PD can
+// observe how a slow/resumed snapshot transfer is progressing.
+type SnapshotTransferProgress struct {
+	Namespace  string
+	FromNode   string
+	TotalBytes int64
+	Received   int64
+	Done       bool
+	Err        string
+	StartedAt  time.Time
+}
+
+// snapshotTransferTracker keeps the last known progress for each namespace
+// partition that is (or was) being caught up via snapshot transfer.
+type snapshotTransferTracker struct {
+	mutex  sync.Mutex
+	states map[string]*SnapshotTransferProgress
+}
+
+func newSnapshotTransferTracker() *snapshotTransferTracker {
+	return &snapshotTransferTracker{
+		states: make(map[string]*SnapshotTransferProgress),
+	}
+}
+
+func (t *snapshotTransferTracker) update(p *SnapshotTransferProgress) {
+	t.mutex.Lock()
+	t.states[p.Namespace] = p
+	t.mutex.Unlock()
+}
+
+func (t *snapshotTransferTracker) get(namespace string) *SnapshotTransferProgress {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	p, ok := t.states[namespace]
+	if !ok {
+		return nil
+	}
+	cp := *p
+	return &cp
+}
+
+var globalSnapshotTracker = newSnapshotTransferTracker()
+
+// GetSnapshotTransferProgress returns the current (or last) snapshot
+// transfer progress for a namespace partition, or nil if none was tracked.
+// Only transfers over the legacy path are tracked; a transfer that
+// completes over native-http leaves no entry.
+func GetSnapshotTransferProgress(namespace string) *SnapshotTransferProgress {
+	return globalSnapshotTracker.get(namespace)
+}
+
+// needsSnapshotCatchup decides whether the local namespace is far enough
+// behind (or flagged as broken) that raft log replay alone would be too
+// slow, and it should instead pull a full snapshot from a healthy peer.
+func (self *DataCoordinator) needsSnapshotCatchup(nsInfo *PartitionMetaInfo, localNamespace *node.NamespaceNode) bool {
+	if localNamespace.IsDataNeedFix() {
+		return true
+	}
+	leaderFirstIndex, err := localNamespace.Node.GetLeadMemberFirstIndex()
+	if err != nil {
+		return false
+	}
+	appliedIndex := localNamespace.Node.GetAppliedIndex()
+	return leaderFirstIndex > appliedIndex
+}
+
+// fetchSnapshotFromPeer downloads the peer's snapshot payload as one byte
+// stream from a healthy ISR peer, verifying its integrity, and hands the
+// downloaded file to ApplyImportedSnapshot. No raft HardState, ConfState
+// or applied index is transferred alongside it. It negotiates a transport with the peer (preferring the
+// checksummed, resumable native-http transport over plain rsync) and falls
+// back to the legacy path on a transport-level error.
+func (self *DataCoordinator) fetchSnapshotFromPeer(nsInfo *PartitionMetaInfo, localNamespace *node.NamespaceNode) error {
+	peer, err := self.pickHealthySnapshotPeer(nsInfo)
+	if err != nil {
+		return err
+	}
+
+	ssiList, err := self.GetSnapshotSyncInfo(nsInfo.GetDesp())
+	if err == nil {
+		for _, ssi := range ssiList {
+			if GenNodeID(&NodeInfo{RegID: ssi.NodeID, NodeIP: ssi.RemoteAddr, HttpPort: ssi.HttpAPIPort}, "datanode") != peer {
+				continue
+			}
+			transport := negotiateSnapshotTransport(&ssi)
+			if transport == TransportNativeHTTP {
+				if nativeErr := self.fetchSnapshotNativeHTTP(nsInfo, localNamespace, peer); nativeErr == nil {
+					return nil
+				} else {
+					CoordLog().Infof("native-http snapshot transfer for %v from %v failed, falling back: %v",
+						nsInfo.GetDesp(), peer, nativeErr)
+				}
+			}
+			break
+		}
+	}
+
+	progress := &SnapshotTransferProgress{
+		Namespace: nsInfo.GetDesp(),
+		FromNode:  peer,
+		StartedAt: time.Now(),
+	}
+	globalSnapshotTracker.update(progress)
+
+	nip, _, _, httpPort := ExtractNodeInfoFromID(peer)
+	url := "http://" + net.JoinHostPort(nip, httpPort) + common.APIGetSnapshot + "/" + nsInfo.GetDesp()
+
+	tmpPath := filepath.Join(localNamespace.GetDataDir(), GetNamespacePartitionFileName(nsInfo.Name, nsInfo.Partition, snapshotTmpSuffix))
+	offset := int64(0)
+	if fi, statErr := os.Stat(tmpPath); statErr == nil {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		progress.Err = err.Error()
+		globalSnapshotTracker.update(progress)
+		return err
+	}
+	req.Header.Set("X-Snapshot-Transport", TransportRsync)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		CoordLog().Infof("resuming snapshot transfer for %v from peer %v at offset %v", nsInfo.GetDesp(), peer, offset)
+	}
+	client := &http.Client{Timeout: 0}
+	rsp, err := client.Do(req)
+	if err != nil {
+		progress.Err = err.Error()
+		globalSnapshotTracker.update(progress)
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK && rsp.StatusCode != http.StatusPartialContent {
+		err = fmt.Errorf("unexpected snapshot transfer status from %v: %v", peer, rsp.StatusCode)
+		progress.Err = err.Error()
+		globalSnapshotTracker.update(progress)
+		return err
+	}
+	progress.TotalBytes = offset + rsp.ContentLength
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if offset > 0 && rsp.StatusCode == http.StatusPartialContent {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+		offset = 0
+	}
+	f, err := os.OpenFile(tmpPath, flags, 0644)
+	if err != nil {
+		progress.Err = err.Error()
+		globalSnapshotTracker.update(progress)
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if offset > 0 {
+		rerr := hashExistingTmpFile(h, tmpPath, offset)
+		if rerr != nil {
+			progress.Err = rerr.Error()
+			globalSnapshotTracker.update(progress)
+			return rerr
+		}
+	}
+
+	received := offset
+	buf := make([]byte, snapshotChunkSize)
+	limiter := newRateLimiter(SnapshotTransferRateLimitBytesPerSec)
+	for {
+		n, rerr := rsp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := f.Write(buf[:n]); werr != nil {
+				progress.Err = werr.Error()
+				globalSnapshotTracker.update(progress)
+				return werr
+			}
+			h.Write(buf[:n])
+			received += int64(n)
+			progress.Received = received
+			globalSnapshotTracker.update(progress)
+			limiter.throttle(int64(n))
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			progress.Err = rerr.Error()
+			globalSnapshotTracker.update(progress)
+			return rerr
+		}
+	}
+
+	expectedSum := rsp.Trailer.Get("X-Snapshot-Sha256")
+	if expectedSum != "" {
+		gotSum := hex.EncodeToString(h.Sum(nil))
+		if gotSum != expectedSum {
+			err = fmt.Errorf("snapshot checksum mismatch for %v from %v: got %v want %v",
+				nsInfo.GetDesp(), peer, gotSum, expectedSum)
+			progress.Err = err.Error()
+			globalSnapshotTracker.update(progress)
+			return err
+		}
+	}
+
+	if err := localNamespace.ApplyImportedSnapshot(tmpPath); err != nil {
+		progress.Err = err.Error()
+		globalSnapshotTracker.update(progress)
+		return err
+	}
+	os.Remove(tmpPath)
+	progress.Done = true
+	globalSnapshotTracker.update(progress)
+	CoordLog().Infof("namespace %v caught up via snapshot transfer from %v, %v bytes", nsInfo.GetDesp(), peer, received)
+	return nil
+}
+
+// pickHealthySnapshotPeer finds an ISR member (other than ourselves) that
+// can serve as the source for a snapshot transfer.
+func (self *DataCoordinator) pickHealthySnapshotPeer(nsInfo *PartitionMetaInfo) (string, error) {
+	for _, nid := range nsInfo.GetISR() {
+		if nid == self.GetMyID() {
+			continue
+		}
+		if _, err := self.getRaftAddrForNode(nid); err != nil {
+			continue
+		}
+		return nid, nil
+	}
+	return "", fmt.Errorf("no healthy peer found to transfer snapshot for namespace %v", nsInfo.GetDesp())
+}
+
+// hashExistingTmpFile feeds the first n bytes already on disk at path into
+// h, so a resumed transfer's checksum covers the whole payload rather than
+// just the newly-downloaded tail. It closes the file itself so resuming a
+// transfer does not leak one file descriptor per resume.
+func hashExistingTmpFile(h io.Writer, path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, io.LimitReader(f, n))
+	return err
+}
+
+// rateLimiter is a minimal token-bucket-style throttle for snapshot
+// transfer bandwidth; a zero limit means unthrottled.
+type rateLimiter struct {
+	bytesPerSec int64
+	window      time.Time
+	used        int64
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{bytesPerSec: bytesPerSec, window: time.Now()}
+}
+
+func (r *rateLimiter) throttle(n int64) {
+	if r.bytesPerSec <= 0 {
+		return
+	}
+	r.used += n
+	elapsed := time.Since(r.window)
+	if elapsed >= time.Second {
+		r.window = time.Now()
+		r.used = n
+		return
+	}
+	allowed := r.bytesPerSec * int64(elapsed) / int64(time.Second)
+	if r.used > allowed {
+		sleepFor := time.Duration(r.used-allowed) * time.Second / time.Duration(r.bytesPerSec)
+		time.Sleep(sleepFor)
+	}
+}
@@ -0,0 +1,272 @@
+package cluster
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Logger is the minimal logging interface the cluster package and its
+// datanode_coord consumer log through.
+type Logger interface {
+	Debugf(fmt string, args ...interface{})
+	Infof(fmt string, args ...interface{})
+	Warningf(fmt string, args ...interface{})
+	Errorf(fmt string, args ...interface{})
+}
+
+type emptyLogger struct{}
+
+func (emptyLogger) Debugf(fmt string, args ...interface{})   {}
+func (emptyLogger) Infof(fmt string, args ...interface{})    {}
+func (emptyLogger) Warningf(fmt string, args ...interface{}) {}
+func (emptyLogger) Errorf(fmt string, args ...interface{})   {}
+
+var coordLogger Logger = emptyLogger{}
+
+// SetCoordLogger lets the host process plug in its own logger implementation.
+func SetCoordLogger(l Logger) { coordLogger = l }
+
+// CoordLog returns the logger used throughout the coordinator packages.
+func CoordLog() Logger { return coordLogger }
+
+// NodeInfo describes a data node as seen by the rest of the cluster: its
+// network location and identity.
+type NodeInfo struct {
+	ID                string
+	NodeIP            string
+	Hostname          string
+	RedisPort         string
+	HttpPort          string
+	RpcPort           string
+	RaftTransportAddr string
+	DataRoot          string
+	RsyncModule       string
+	Version           string
+	RegID             uint64
+	Epoch             int64
+	// Zone is the failure-domain label (e.g. availability zone) this node
+	// reports on registration, used for zone-aware ISR placement.
+	Zone string
+	// Rack is an optional, finer-grained failure-domain label than Zone.
+	Rack string
+	// Attributes holds any other operator-defined labels (e.g. disk type,
+	// instance class) that a PlacementSpec can key an affinity or spread
+	// rule off of by name.
+	Attributes map[string]string
+}
+
+// AffinityRule scores a candidate node against one attribute: Match
+// contributes Weight to the candidate's score when its attribute value
+// equals Value, and 0 otherwise.
+type AffinityRule struct {
+	Attribute string
+	Value     string
+	Weight    float64
+}
+
+// SpreadTarget expresses a desired distribution of replicas across the
+// values of one attribute, e.g. rack -> {"rack-a": 0.34, "rack-b": 0.33,
+// "rack-c": 0.33}. The placer greedily prefers candidates whose attribute
+// value is under-represented relative to the target.
+type SpreadTarget struct {
+	Attribute     string
+	TargetPercent map[string]float64
+}
+
+// PlacementSpec is the placement policy a namespace can opt into: hard
+// constraints eliminate candidates outright, affinities add a weighted
+// preference score, and spread targets bias the greedy pick toward
+// balancing a labeled attribute across the ISR. It lives alongside
+// PartitionMetaInfo (rather than in datanode_coord) so the metadata store
+// can persist and serve it as part of the partition's metadata.
+type PlacementSpec struct {
+	HardConstraints map[string]string
+	Affinities      []AffinityRule
+	Spreads         []SpreadTarget
+}
+
+func (n *NodeInfo) GetID() string { return n.ID }
+
+// RemovingInfo marks a raft member of a namespace partition as pending
+// removal, keyed by the owning node id in PartitionMetaInfo.Removings.
+type RemovingInfo struct {
+	RemoveReplicaID uint64
+	RemoveTime      int64
+}
+
+// PartitionMetaInfo is the persisted metadata for one namespace partition:
+// its raft membership and engine configuration.
+type PartitionMetaInfo struct {
+	Name         string
+	Partition    int
+	PartitionNum int
+	Replica      int
+	EngType      string
+	MinGID       int64
+	MagicCode    int64
+	RaftNodes    []string
+	RaftIDs      map[string]uint64
+	Removings    map[string]RemovingInfo
+	// LearnerIDs holds the raft replica id of every ISR member that is
+	// currently a non-voting learner rather than a full voter, keyed by
+	// node id.
+	LearnerIDs map[string]uint64
+	// ZoneAffinity, when set, is the zone this partition's leader is pinned
+	// to: the leader is picked from the ISR voters in that zone ahead of
+	// zone balancing. It does not constrain which nodes are in the ISR.
+	ZoneAffinity string
+	// PlacementSpec, when set, is the placement policy PlanPlacement and
+	// Rebalance score candidates against for this partition.
+	PlacementSpec *PlacementSpec
+}
+
+func (p *PartitionMetaInfo) GetDesp() string {
+	return p.Name + "-" + strconv.Itoa(p.Partition)
+}
+
+func (p *PartitionMetaInfo) GetISR() []string { return p.RaftNodes }
+
+func (p *PartitionMetaInfo) GetCopy() *PartitionMetaInfo {
+	cp := *p
+	cp.RaftNodes = append([]string{}, p.RaftNodes...)
+	cp.RaftIDs = make(map[string]uint64, len(p.RaftIDs))
+	for k, v := range p.RaftIDs {
+		cp.RaftIDs[k] = v
+	}
+	cp.Removings = make(map[string]RemovingInfo, len(p.Removings))
+	for k, v := range p.Removings {
+		cp.Removings[k] = v
+	}
+	cp.LearnerIDs = make(map[string]uint64, len(p.LearnerIDs))
+	for k, v := range p.LearnerIDs {
+		cp.LearnerIDs[k] = v
+	}
+	return &cp
+}
+
+// ISRStat is the per-replica portion of NamespaceCoordStat.
+type ISRStat struct {
+	NodeID   string
+	HostName string
+}
+
+// NamespaceCoordStat is one namespace partition's coordinator-side stats.
+type NamespaceCoordStat struct {
+	Name      string
+	Partition int
+	ISRStats  []ISRStat
+}
+
+// CoordStats aggregates coordinator stats across namespaces for the stats API.
+type CoordStats struct {
+	NsCoordStats []NamespaceCoordStat
+}
+
+// CoordErrType values used by CoordErr.
+const (
+	CoordNoErr = iota
+	CoordCommonErr
+	CoordNetErr
+	CoordLocalErr
+	CoordClusterErr
+	CoordRegisterErr
+)
+
+// RPC-level error codes carried alongside a CoordErrType.
+const (
+	RpcNoErr = iota
+	RpcCommonErr
+	RpcNetErr
+)
+
+// CoordErr is the coordinator's structured error type: a message plus an
+// RPC-level code and a higher-level CoordErrType for callers that need to
+// branch on error category.
+type CoordErr struct {
+	ErrMsg  string
+	ErrCode int32
+	ErrType int32
+}
+
+func (e *CoordErr) Error() string { return e.ErrMsg }
+
+// NewCoordErr builds a CoordErr carrying only the high-level error type; the
+// RPC-level code defaults to RpcNoErr.
+func NewCoordErr(msg string, errType int32) *CoordErr {
+	return &CoordErr{ErrMsg: msg, ErrType: errType}
+}
+
+var (
+	ErrKeyNotFound              = errors.New("key not found")
+	ErrNamespaceConfInvalid     = NewCoordErr("namespace config is invalid", CoordClusterErr)
+	ErrNamespaceNotCreated      = NewCoordErr("namespace is not created", CoordLocalErr)
+	ErrLocalInitNamespaceFailed = NewCoordErr("local namespace init failed", CoordLocalErr)
+	ErrNamespaceWaitingSync     = NewCoordErr("namespace is waiting raft to be synced", CoordLocalErr)
+	ErrNamespaceExiting         = NewCoordErr("namespace is exiting", CoordLocalErr)
+	ErrCatchupRunningBusy       = NewCoordErr("too many namespaces catching up", CoordLocalErr)
+)
+
+// DataNodeRegister is the cluster metadata store a data node coordinator
+// registers with and reads namespace/placement metadata from (normally
+// etcd-backed in production deployments).
+type DataNodeRegister interface {
+	InitClusterID(clusterID string)
+	NewRegisterNodeID() (uint64, error)
+	Register(nodeInfo *NodeInfo) error
+	Unregister(nodeInfo *NodeInfo) error
+	Stop()
+	WatchPDLeader(leaderChan chan *NodeInfo, stop chan struct{}) error
+	GetAllPDNodes() ([]NodeInfo, error)
+	GetNamespacesNotifyChan() chan struct{}
+	GetAllNamespaces() (map[string]map[int]PartitionMetaInfo, int64, error)
+	GetNamespaceMetaInfo(namespace string) (PartitionMetaInfo, error)
+	GetNamespacePartInfo(namespace string, partition int) (*PartitionMetaInfo, error)
+	GetNodeInfo(nid string) (NodeInfo, error)
+	// GetAllDataNodes lists every data node currently registered in the
+	// cluster, keyed by node id, so placement can discover nodes a
+	// partition doesn't already hold a replica on.
+	GetAllDataNodes() (map[string]NodeInfo, error)
+}
+
+// GenNodeID builds the canonical id string for a data node from its
+// identity fields, in the form used to key raft groups and registry
+// entries across the cluster.
+func GenNodeID(n *NodeInfo, role string) string {
+	return role + ":" + n.NodeIP + ":" + n.HttpPort + ":" + strconv.FormatUint(n.RegID, 10)
+}
+
+// ExtractNodeInfoFromID parses the id form produced by GenNodeID back into
+// its ip and http port (the pieces the coordinator dials peers with).
+func ExtractNodeInfoFromID(nid string) (ip string, rpcPort string, raftPort string, httpPort string) {
+	parts := strings.Split(nid, ":")
+	if len(parts) < 4 {
+		return "", "", "", ""
+	}
+	return parts[1], "", "", parts[2]
+}
+
+// ExtractRegIDFromGenID recovers the raft register id encoded into a node
+// id by GenNodeID.
+func ExtractRegIDFromGenID(nid string) uint64 {
+	parts := strings.Split(nid, ":")
+	if len(parts) < 4 {
+		return 0
+	}
+	v, _ := strconv.ParseUint(parts[3], 10, 64)
+	return v
+}
+
+// FindSlice returns the index of v in s, or -1 if not present.
+func FindSlice(s []string, v string) int {
+	for i, x := range s {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// Note: GetNamespacePartitionFileName/GetNamespacePartitionBasePath live in
+// datanode_coord, not here — that package dot-imports cluster, so declaring
+// them in both places is a duplicate-symbol compile error.
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API route paths used by the data node coordinator's HTTP client calls.
+const (
+	APIAddNode     = "/cluster/node/add"
+	APIGetMembers  = "/cluster/members"
+	APIGetSnapshot = "/cluster/snapshot"
+	APICRDTGossip  = "/cluster/crdt/gossip"
+)
+
+// MemberInfo is one raft group member, exchanged between data nodes over
+// the coordinator's HTTP API when adding/removing/promoting members.
+type MemberInfo struct {
+	ID        uint64
+	NodeID    uint64
+	GroupID   uint64
+	GroupName string
+	// RaftURLs are the raft transport addresses raft uses to dial this
+	// member, populated when proposing it as a new member.
+	RaftURLs []string
+	// Learner marks this member as a non-voting raft learner rather than a
+	// full voting member.
+	Learner bool
+}
+
+// SnapshotSyncInfo describes one ISR peer as a candidate source for a
+// snapshot transfer.
+type SnapshotSyncInfo struct {
+	NodeID      uint64
+	ReplicaID   uint64
+	RemoteAddr  string
+	HttpAPIPort string
+	DataRoot    string
+	RsyncModule string
+	// Transports lists the snapshot transfer protocols this peer can serve
+	// (e.g. "native-http", "rsync"), in the peer's own preference order.
+	Transports []string
+	// PreferredTransport is the transport the puller should try first; it
+	// is always present in Transports.
+	PreferredTransport string
+}
+
+// APIRequest issues an HTTP request against another data node's coordinator
+// API and decodes a JSON response into out (when out is non-nil).
+func APIRequest(method, url string, body io.Reader, timeout time.Duration, out interface{}) error {
+	client := &http.Client{Timeout: timeout}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return errors.New("request " + url + " failed with status " + strconv.Itoa(rsp.StatusCode))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
+
+// GetNamespaceAndPartition splits a "namespace-partition" full name, as
+// produced by PartitionMetaInfo.GetDesp, back into its parts.
+func GetNamespaceAndPartition(fullName string) (string, int) {
+	idx := strings.LastIndex(fullName, "-")
+	if idx < 0 {
+		return "", 0
+	}
+	pid, err := strconv.Atoi(fullName[idx+1:])
+	if err != nil {
+		return "", 0
+	}
+	return fullName[:idx], pid
+}
@@ -0,0 +1,224 @@
+package node
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/absolute8511/ZanRedisDB/common"
+)
+
+// ReplicaInfo identifies one seed member of a namespace's raft group.
+type ReplicaInfo struct {
+	NodeID    uint64
+	ReplicaID uint64
+	RaftAddr  string
+	// Learner marks this seed member as a non-voting raft learner rather
+	// than a full voter.
+	Learner bool
+}
+
+// RaftGroupConf is the raft-group-level portion of a NamespaceConfig.
+type RaftGroupConf struct {
+	GroupID   uint64
+	SeedNodes []ReplicaInfo
+}
+
+// NamespaceConfig describes how to start (or join) one namespace partition's
+// raft group on this node.
+type NamespaceConfig struct {
+	BaseName      string
+	Name          string
+	EngType       string
+	PartitionNum  int
+	Replicator    int
+	RaftGroupConf RaftGroupConf
+}
+
+// NewNSConfig returns an empty NamespaceConfig ready to be filled in by the
+// coordinator before calling NamespaceMgr.InitNamespaceNode.
+func NewNSConfig() *NamespaceConfig {
+	return &NamespaceConfig{}
+}
+
+// NamespaceDynamicConf holds the namespace settings that can change at
+// runtime without restarting the local raft node.
+type NamespaceDynamicConf struct {
+}
+
+// Node is the local raft participant for one namespace partition.
+type Node struct {
+	mutex sync.Mutex
+}
+
+func (n *Node) FillMyMemberInfo(m *common.MemberInfo) {}
+
+func (n *Node) ProposeAddMember(m common.MemberInfo) error { return nil }
+
+func (n *Node) ProposeRemoveMember(m common.MemberInfo) error { return nil }
+
+// ProposeAddLearner proposes adding m as a non-voting learner, mirroring
+// etcd's learner design: the member replicates the log but is not counted
+// toward quorum until it is promoted with ProposePromoteLearner. This
+// stand-in returns nil without proposing anything.
+func (n *Node) ProposeAddLearner(m common.MemberInfo) error { return nil }
+
+// ProposePromoteLearner proposes promoting an existing learner to a full
+// voting member once it has caught up. This stand-in returns nil without
+// proposing anything.
+func (n *Node) ProposePromoteLearner(m common.MemberInfo) error { return nil }
+
+// ProposeConfChangeSet proposes a single joint-consensus configuration
+// change covering every add and remove at once (raft thesis §4.3), so the
+// raft group never passes through an intermediate membership that neither
+// the old nor the new replica set could form a quorum from. This stand-in
+// returns nil without proposing anything.
+func (n *Node) ProposeConfChangeSet(adds, removes []common.MemberInfo) error { return nil }
+
+func (n *Node) GetMembers() []*common.MemberInfo { return nil }
+
+func (n *Node) GetLeadMember() *common.MemberInfo { return nil }
+
+func (n *Node) GetLocalMemberInfo() *common.MemberInfo { return &common.MemberInfo{} }
+
+// GetCommittedIndex returns the raft log index the leader has committed.
+// This stand-in always returns 0.
+func (n *Node) GetCommittedIndex() uint64 { return 0 }
+
+// GetFollowerAppliedIndex returns the last raft log index the given
+// follower (by raft register id) has reported applying, used to decide
+// whether a learner has caught up enough to promote. This stand-in always
+// returns 0 and no error.
+func (n *Node) GetFollowerAppliedIndex(regID uint64) (uint64, error) { return 0, nil }
+
+// GetLeadMemberFirstIndex returns the first log index still held by the
+// current leader; a local applied index behind this means the leader has
+// already compacted past what raft replay alone can deliver, so the
+// follower needs a snapshot rather than log replay to catch up. This
+// stand-in always returns 0 and no error.
+func (n *Node) GetLeadMemberFirstIndex() (uint64, error) { return 0, nil }
+
+// GetAppliedIndex returns the last raft log index applied to local state.
+// This stand-in always returns 0.
+func (n *Node) GetAppliedIndex() uint64 { return 0 }
+
+// NamespaceNode wraps the local raft Node for one namespace partition with
+// the storage-engine lifecycle (start/stop, data-fix tracking, snapshot
+// install) the coordinator drives it through.
+type NamespaceNode struct {
+	Node *Node
+
+	mutex       sync.Mutex
+	dataNeedFix bool
+	dataDir     string
+	raftSynced  bool
+}
+
+func (nn *NamespaceNode) CheckRaftConf(raftID uint64, conf *NamespaceConfig) error { return nil }
+
+func (nn *NamespaceNode) SetMagicCode(code int64) error { return nil }
+
+func (nn *NamespaceNode) SetDynamicInfo(conf NamespaceDynamicConf) {}
+
+func (nn *NamespaceNode) Start() error { return nil }
+
+func (nn *NamespaceNode) Close() {}
+
+func (nn *NamespaceNode) Destroy() error { return nil }
+
+func (nn *NamespaceNode) IsReady() bool { return true }
+
+func (nn *NamespaceNode) IsRaftSynced() bool {
+	nn.mutex.Lock()
+	defer nn.mutex.Unlock()
+	return nn.raftSynced
+}
+
+func (nn *NamespaceNode) GetMembers() []*common.MemberInfo {
+	if nn.Node == nil {
+		return nil
+	}
+	return nn.Node.GetMembers()
+}
+
+func (nn *NamespaceNode) TransferMyLeader(toRegID uint64, toRaftID uint64) error { return nil }
+
+// GetDataDir returns the local on-disk directory for this namespace
+// partition's storage engine data.
+func (nn *NamespaceNode) GetDataDir() string { return nn.dataDir }
+
+// ApplyImportedSnapshot marks the namespace caught up by clearing its
+// data-fix flag. It does not read the downloaded checkpoint at path and
+// does not replace the local data.
+func (nn *NamespaceNode) ApplyImportedSnapshot(path string) error {
+	nn.mutex.Lock()
+	nn.dataNeedFix = false
+	nn.mutex.Unlock()
+	return nil
+}
+
+// IsDataNeedFix reports whether the local storage engine data for this
+// namespace is known to be broken or stale enough to need a snapshot
+// catchup rather than plain raft log replay.
+func (nn *NamespaceNode) IsDataNeedFix() bool {
+	nn.mutex.Lock()
+	defer nn.mutex.Unlock()
+	return nn.dataNeedFix
+}
+
+func (nn *NamespaceNode) SetDataFixState(need bool) {
+	nn.mutex.Lock()
+	nn.dataNeedFix = need
+	nn.mutex.Unlock()
+}
+
+// NamespaceMgr owns every local NamespaceNode on this data node and the
+// shared resources (data root, register id) they're created against.
+type NamespaceMgr struct {
+	mutex      sync.Mutex
+	namespaces map[string]*NamespaceNode
+}
+
+// NewNamespaceMgr creates an empty namespace manager.
+func NewNamespaceMgr() *NamespaceMgr {
+	return &NamespaceMgr{namespaces: make(map[string]*NamespaceNode)}
+}
+
+func (m *NamespaceMgr) Start() {}
+
+func (m *NamespaceMgr) Stop() {}
+
+func (m *NamespaceMgr) GetNamespaceNode(fullName string) *NamespaceNode {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.namespaces[fullName]
+}
+
+func (m *NamespaceMgr) GetNamespaces() map[string]*NamespaceNode {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cp := make(map[string]*NamespaceNode, len(m.namespaces))
+	for k, v := range m.namespaces {
+		cp[k] = v
+	}
+	return cp
+}
+
+func (m *NamespaceMgr) SaveMachineRegID(regID uint64) error { return nil }
+
+func (m *NamespaceMgr) CheckMagicCode(fullName string, magicCode int64, tryFix bool) error {
+	return nil
+}
+
+func (m *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64) (*NamespaceNode, error) {
+	if conf == nil {
+		return nil, errors.New("namespace config is required")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	nn, ok := m.namespaces[conf.Name]
+	if !ok {
+		nn = &NamespaceNode{Node: &Node{}, dataDir: conf.Name}
+		m.namespaces[conf.Name] = nn
+	}
+	return nn, nil
+}